@@ -0,0 +1,129 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	ErrApplyInvalidDelta     = errors.New("delta doesn't match origin signature")
+	ErrApplyInvalidOriginal  = errors.New("original data doesn't match origin signature")
+	ErrApplyChecksumMismatch = errors.New("checksum of updated data doesn't match delta checksum")
+)
+
+// Apply writes to w updated data reconstructed from original data and delta calculated against origin signature
+func Apply(w io.Writer, original io.Reader, originSignature Signature, delta Delta, opts ...Option) error {
+	return ApplyContext(context.Background(), w, original, originSignature, delta, opts...)
+}
+
+// ApplyContext writes to w updated data reconstructed from original data and delta calculated against origin signature,
+// ctx is checked between original chunks and its error is returned as soon as it's done.
+// If delta has checksum it's verified after all data is written, ErrApplyChecksumMismatch is returned on mismatch.
+// progress reports bytes written to w and original chunks copied as matched chunks
+func ApplyContext(ctx context.Context, w io.Writer, original io.Reader, originSignature Signature, delta Delta, opts ...Option) error {
+	return apply(ctx, w, original, originSignature, delta, nil, opts)
+}
+
+// applies delta, inverse delta is written with inverse writer if it isn't nil
+func apply(ctx context.Context, w io.Writer, original io.Reader, originSignature Signature, delta Delta, inverse *inverseWriter, opts []Option) error {
+	if originSignature.ChunkSize <= 0 {
+		return ErrCalculateSignatureInvalidChunkSize
+	}
+
+	chunksCount := len(originSignature.ChunksHashes)
+	additions, deletions, err := groupDeltaOperations(delta, chunksCount)
+	if err != nil {
+		return err
+	}
+
+	progress := newProgressReporter(newOptions(opts))
+
+	var checksum HashCalculator
+	if len(delta.Checksum) > 0 {
+		checksum = NewChecksumCalculator()
+		w = io.MultiWriter(w, checksum)
+	}
+
+	chunk := make([]byte, originSignature.ChunkSize)
+	for i := 0; i <= chunksCount; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for _, data := range additions[i] {
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			progress.addBytes(len(data))
+			if inverse != nil {
+				inverse.skip(len(data))
+			}
+		}
+		if i == chunksCount {
+			break
+		}
+
+		n, err := io.ReadFull(original, chunk)
+		isLastChunk := i == chunksCount-1
+		if err == io.ErrUnexpectedEOF && isLastChunk {
+			err = nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrApplyInvalidOriginal
+		}
+		if err != nil {
+			return err
+		}
+
+		if !deletions[i] {
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return err
+			}
+			progress.addBytes(n)
+			progress.addChunkMatched()
+		}
+		if inverse != nil {
+			if err := inverse.chunk(chunk[:n], !deletions[i]); err != nil {
+				return err
+			}
+		}
+		progress.report()
+	}
+
+	if checksum != nil && !bytes.Equal(checksum.Sum(nil), delta.Checksum) {
+		return ErrApplyChecksumMismatch
+	}
+	if inverse != nil {
+		if err := inverse.finish(); err != nil {
+			return err
+		}
+	}
+	progress.finish()
+	return nil
+}
+
+// returns data of addition operations grouped by chunk index and flags of deleted chunks,
+// additions for index equal to chunks count are appended at the end
+func groupDeltaOperations(delta Delta, chunksCount int) (map[int][][]byte, []bool, error) {
+	additions := make(map[int][][]byte)
+	deletions := make([]bool, chunksCount)
+	for _, op := range delta.Operations {
+		switch op.Type {
+		case OperationTypeAddition:
+			if op.ChunkIndex < 0 || op.ChunkIndex > chunksCount {
+				return nil, nil, ErrApplyInvalidDelta
+			}
+			additions[op.ChunkIndex] = append(additions[op.ChunkIndex], op.Data)
+		case OperationTypeDeletion:
+			if op.ChunkIndex < 0 || op.ChunkIndex >= chunksCount {
+				return nil, nil, ErrApplyInvalidDelta
+			}
+			deletions[op.ChunkIndex] = true
+		default:
+			return nil, nil, ErrApplyInvalidDelta
+		}
+	}
+	return additions, deletions, nil
+}
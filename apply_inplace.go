@@ -0,0 +1,303 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/iox"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// ReadWriterAt is storage updated in place, e.g. *os.File of disk image or block device
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// size of buffer used to copy data within storage
+const inPlaceCopyBufferSize = 1024 * 1024
+
+// ApplyInPlace reconstructs updated data over original data stored in rw and returns size of updated data.
+// Storage isn't truncated, so if updated data is shorter than original the caller should truncate it.
+func ApplyInPlace(rw ReadWriterAt, originSignature Signature, delta Delta, opts ...Option) (int64, error) {
+	return ApplyInPlaceContext(context.Background(), rw, originSignature, delta, opts...)
+}
+
+// ApplyInPlaceContext reconstructs updated data over original data stored in rw and returns size of updated data.
+// Copied regions are ordered so that no region is overwritten before it's read, cycles of regions depending
+// on each other are broken by buffering pieces of at most chunk size in memory. Original data is destroyed as soon
+// as the first region is written, so it has to match origin signature. If delta has checksum it's verified by reading updated data back,
+// ErrApplyChecksumMismatch is returned on mismatch.
+func ApplyInPlaceContext(ctx context.Context, rw ReadWriterAt, originSignature Signature, delta Delta, opts ...Option) (int64, error) {
+	segments, err := deltaLayout(originSignature, delta)
+	if err != nil {
+		return 0, err
+	}
+	size := layoutSize(segments)
+
+	progress := newProgressReporter(newOptions(opts))
+
+	literals := make([]segment, 0)
+	for _, s := range segments {
+		if !s.isCopy() {
+			literals = append(literals, s)
+		}
+	}
+
+	buf := make([]byte, inPlaceCopyBufferSize)
+	moves := copyMoves(originSignature, segments)
+	err = scheduleMoves(moves, int64(originSignature.ChunkSize), func(m move) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := copyWithin(rw, m, buf); err != nil {
+			return err
+		}
+		progress.addBytes(int(m.length))
+		progress.report()
+		return nil
+	}, func(m move) error {
+		// source of move in cycle is read before anything overwrites it and written with literals
+		data := make([]byte, m.length)
+		if err := iox.ReadFullAt(rw, data, m.src); err != nil {
+			return err
+		}
+		literals = append(literals, segment{offset: m.dst, length: m.length, chunkIndex: -1, data: data})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range literals {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if _, err := rw.WriteAt(s.data, s.offset); err != nil {
+			return 0, err
+		}
+		progress.addBytes(len(s.data))
+		progress.report()
+	}
+
+	if len(delta.Checksum) > 0 {
+		checksum := NewChecksumCalculator()
+		if _, err := io.Copy(checksum, io.NewSectionReader(rw, 0, size)); err != nil {
+			return 0, err
+		}
+		if !bytes.Equal(checksum.Sum(nil), delta.Checksum) {
+			return 0, ErrApplyChecksumMismatch
+		}
+	}
+	progress.finish()
+	return size, nil
+}
+
+// move copies region of storage from src to dst offset
+type move struct {
+	src    int64
+	dst    int64
+	length int64
+}
+
+// returns moves of copied origin chunks, adjacent chunks are merged and chunks staying in place are skipped
+func copyMoves(originSignature Signature, segments []segment) []move {
+	chunkSize := int64(originSignature.ChunkSize)
+	moves := make([]move, 0)
+	for _, s := range segments {
+		if !s.isCopy() {
+			continue
+		}
+		src := int64(s.chunkIndex) * chunkSize
+		if n := len(moves); n > 0 {
+			last := &moves[n-1]
+			if last.src+last.length == src && last.dst+last.length == s.offset {
+				last.length += s.length
+				continue
+			}
+		}
+		moves = append(moves, move{src: src, dst: s.offset, length: s.length})
+	}
+
+	inPlace := moves[:0]
+	for _, m := range moves {
+		if m.src != m.dst {
+			inPlace = append(inPlace, m)
+		}
+	}
+	return inPlace
+}
+
+// dependency of move writing region on move reading it, it's dropped when reader completes
+// or when buffered pieces shrink moves so that they no longer overlap
+type moveEdge struct {
+	reader int
+	writer int
+	alive  bool
+}
+
+// calls run for every move after moves whose sources it overwrites. When remaining moves depend on each other
+// in cycle, piece of at most maxLength of one move in the cycle is passed to buffer and the move is shrunk,
+// until the cycle is broken. Sources of moves mustn't overlap, which holds because every origin chunk
+// is copied at most once.
+func scheduleMoves(moves []move, maxLength int64, run, buffer func(move) error) error {
+	// moves are shrunk in place, so caller's slice isn't modified
+	moves = append([]move(nil), moves...)
+
+	bySrc := make([]int, len(moves))
+	for i := range bySrc {
+		bySrc[i] = i
+	}
+	sort.Slice(bySrc, func(i, j int) bool {
+		return moves[bySrc[i]].src < moves[bySrc[j]].src
+	})
+
+	// move has to wait for moves reading regions it writes
+	edges := make([]moveEdge, 0)
+	waitsFor := make([]int, len(moves))
+	readers := make([][]int, len(moves))
+	writers := make([][]int, len(moves))
+	for i, m := range moves {
+		first := sort.Search(len(bySrc), func(k int) bool {
+			r := moves[bySrc[k]]
+			return r.src+r.length > m.dst
+		})
+		for k := first; k < len(bySrc) && moves[bySrc[k]].src < m.dst+m.length; k++ {
+			j := bySrc[k]
+			if j == i {
+				// overlap with own source is handled by copying in the right direction
+				continue
+			}
+			readers[i] = append(readers[i], len(edges))
+			writers[j] = append(writers[j], len(edges))
+			edges = append(edges, moveEdge{reader: j, writer: i, alive: true})
+			waitsFor[i]++
+		}
+	}
+
+	done := make([]bool, len(moves))
+	ready := make([]int, 0)
+	for i := range moves {
+		if waitsFor[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	drop := func(e int) {
+		edges[e].alive = false
+		w := edges[e].writer
+		waitsFor[w]--
+		if waitsFor[w] == 0 && !done[w] {
+			ready = append(ready, w)
+		}
+	}
+	complete := func(i int) {
+		done[i] = true
+		for _, e := range writers[i] {
+			if edges[e].alive {
+				drop(e)
+			}
+		}
+	}
+	// returns move which move i waits for, dropped edges are removed on the way
+	dependency := func(i int) int {
+		for {
+			e := readers[i][len(readers[i])-1]
+			if edges[e].alive {
+				return edges[e].reader
+			}
+			readers[i] = readers[i][:len(readers[i])-1]
+		}
+	}
+
+	// visited[i] is number of the last walk visiting move i
+	visited := make([]int, len(moves))
+	walk := 0
+	first := 0
+	for remaining := len(moves); remaining > 0; {
+		if len(ready) > 0 {
+			i := ready[len(ready)-1]
+			ready = ready[:len(ready)-1]
+			if err := run(moves[i]); err != nil {
+				return err
+			}
+			complete(i)
+			remaining--
+			continue
+		}
+
+		// every remaining move waits for another one, so following dependencies from any of them ends in cycle
+		for done[first] {
+			first++
+		}
+		walk++
+		writer, reader := -1, first
+		for visited[reader] != walk {
+			visited[reader] = walk
+			writer, reader = reader, dependency(reader)
+		}
+
+		// piece of reader overlapping region of writer is buffered, so their dependency is weakened or dropped
+		m := &moves[reader]
+		w := moves[writer]
+		length := mathx.MinInt64(maxLength, m.length)
+		offset := int64(0)
+		overlapFrom := mathx.MaxInt64(m.src, w.dst)
+		overlapTo := mathx.MinInt64(m.src+m.length, w.dst+w.length)
+		if overlapFrom-m.src > m.src+m.length-overlapTo {
+			offset = m.length - length
+		}
+		if err := buffer(move{src: m.src + offset, dst: m.dst + offset, length: length}); err != nil {
+			return err
+		}
+		if length == m.length {
+			complete(reader)
+			remaining--
+			continue
+		}
+
+		m.length -= length
+		if offset == 0 {
+			m.src += length
+			m.dst += length
+		}
+		for _, e := range writers[reader] {
+			if edges[e].alive && !overlap(moves[edges[e].writer].dst, moves[edges[e].writer].length, m.src, m.length) {
+				drop(e)
+			}
+		}
+		for _, e := range readers[reader] {
+			if edges[e].alive && !overlap(moves[edges[e].reader].src, moves[edges[e].reader].length, m.dst, m.length) {
+				drop(e)
+			}
+		}
+	}
+	return nil
+}
+
+// reports whether regions [a, a+aLength) and [b, b+bLength) overlap
+func overlap(a, aLength, b, bLength int64) bool {
+	return a < b+bLength && b < a+aLength
+}
+
+// copies region within storage, overlapping regions are copied like with memmove
+func copyWithin(rw ReadWriterAt, m move, buf []byte) error {
+	blockSize := int64(len(buf))
+	for copied := int64(0); copied < m.length; {
+		n := mathx.MinInt64(blockSize, m.length-copied)
+		offset := copied
+		if m.dst > m.src {
+			// moving forward copies from the end, so not yet copied data isn't overwritten
+			offset = m.length - copied - n
+		}
+		if err := iox.ReadFullAt(rw, buf[:n], m.src+offset); err != nil {
+			return err
+		}
+		if _, err := rw.WriteAt(buf[:n], m.dst+offset); err != nil {
+			return err
+		}
+		copied += n
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStorage is ReadWriterAt growing on writes past its end
+type memoryStorage struct {
+	data []byte
+}
+
+func (m *memoryStorage) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(m.data).ReadAt(p, off)
+}
+
+func (m *memoryStorage) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+func TestApplyInPlace(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEEEEFFFFGG")
+
+	cases := map[string]struct {
+		givenUpdated []byte
+	}{
+		"equal data": {
+			givenUpdated: original,
+		},
+		"insertion shifts chunks forward": {
+			givenUpdated: []byte("XXAAAABBBBCCCCDDDDEEEEFFFFGG"),
+		},
+		"deletion shifts chunks backward": {
+			givenUpdated: []byte("AAAACCCCDDDDEEEEFFFFGG"),
+		},
+		"chunks shifted both ways": {
+			givenUpdated: []byte("AAAAXXXXXXXXXXCCCCEEEEFFFFYY"),
+		},
+		"data truncated": {
+			givenUpdated: []byte("BBBBCCCC"),
+		},
+		"data extended": {
+			givenUpdated: []byte("AAAABBBBCCCCDDDDEEEEFFFFGGGGHHHHIIII"),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			signature, err := SignatureFromReader(bytes.NewReader(original), 4)
+			assert.NoError(t, err)
+			delta, err := DeltaFromReader(bytes.NewReader(c.givenUpdated), signature)
+			assert.NoError(t, err)
+
+			storage := &memoryStorage{data: append([]byte{}, original...)}
+			size, err := ApplyInPlace(storage, signature, delta)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(c.givenUpdated)), size)
+			assert.Equal(t, string(c.givenUpdated), string(storage.data[:size]))
+		})
+	}
+}
+
+func TestApplyInPlace_Err(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDD")
+	signature, err := SignatureFromReader(bytes.NewReader(original), 4)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader([]byte("AAAACCCCDDDD")), signature)
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		givenOriginal []byte
+		givenDelta    Delta
+		expected      error
+	}{
+		"err original doesn't match signature": {
+			givenOriginal: []byte("AAAABBBBCCCCDDDX"),
+			givenDelta:    delta,
+			expected:      ErrApplyChecksumMismatch,
+		},
+		"err invalid delta": {
+			givenOriginal: original,
+			givenDelta: Delta{
+				Operations: []DeltaOperation{{Type: OperationTypeDeletion, ChunkIndex: 4}},
+			},
+			expected: ErrApplyInvalidDelta,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			storage := &memoryStorage{data: append([]byte{}, c.givenOriginal...)}
+			_, err := ApplyInPlace(storage, signature, c.givenDelta)
+			assert.Equal(t, c.expected, err)
+		})
+	}
+}
+
+func TestScheduleMoves(t *testing.T) {
+	cases := map[string]struct {
+		givenData      string
+		givenMoves     []move
+		givenMaxLength int64
+		expected       string
+		expectedBuffer []move
+	}{
+		"chain is ordered": {
+			givenData: "AAAABBBBCCCC____",
+			givenMoves: []move{
+				{src: 0, dst: 4, length: 4},
+				{src: 4, dst: 8, length: 4},
+				{src: 8, dst: 12, length: 4},
+			},
+			givenMaxLength: 16,
+			expected:       "AAAAAAAABBBBCCCC",
+		},
+		"swapped regions are buffered": {
+			givenData: "AAAABBBBBB",
+			givenMoves: []move{
+				{src: 0, dst: 6, length: 4},
+				{src: 4, dst: 0, length: 6},
+			},
+			givenMaxLength: 16,
+			expected:       "BBBBBBAAAA",
+			expectedBuffer: []move{{src: 0, dst: 6, length: 4}},
+		},
+		"rotation is buffered once": {
+			givenData: "AAAABBBBCCCC",
+			givenMoves: []move{
+				{src: 0, dst: 4, length: 4},
+				{src: 4, dst: 8, length: 4},
+				{src: 8, dst: 0, length: 4},
+			},
+			givenMaxLength: 16,
+			expected:       "CCCCAAAABBBB",
+			expectedBuffer: []move{{src: 0, dst: 4, length: 4}},
+		},
+		"overlap with own source": {
+			givenData: "AAAAAABBBB",
+			givenMoves: []move{
+				{src: 0, dst: 2, length: 6},
+			},
+			givenMaxLength: 16,
+			expected:       "AAAAAAAABB",
+		},
+		"independent swaps are buffered once each": {
+			givenData: "AAAABBBBCCCCDDDD",
+			givenMoves: []move{
+				{src: 0, dst: 4, length: 4},
+				{src: 4, dst: 0, length: 4},
+				{src: 8, dst: 12, length: 4},
+				{src: 12, dst: 8, length: 4},
+			},
+			givenMaxLength: 4,
+			expected:       "BBBBAAAADDDDCCCC",
+			expectedBuffer: []move{
+				{src: 0, dst: 4, length: 4},
+				{src: 8, dst: 12, length: 4},
+			},
+		},
+		"piece of long move in cycle is buffered": {
+			givenData: "AAAAAAAABB",
+			givenMoves: []move{
+				{src: 0, dst: 2, length: 8},
+				{src: 8, dst: 0, length: 2},
+			},
+			givenMaxLength: 4,
+			expected:       "BBAAAAAAAA",
+			expectedBuffer: []move{
+				{src: 0, dst: 2, length: 4},
+			},
+		},
+		"rotation longer than chunk is buffered in pieces": {
+			givenData: "AAAAAABBBBBBCCCCCC",
+			givenMoves: []move{
+				{src: 0, dst: 6, length: 6},
+				{src: 6, dst: 12, length: 6},
+				{src: 12, dst: 0, length: 6},
+			},
+			givenMaxLength: 4,
+			expected:       "CCCCCCAAAAAABBBBBB",
+			expectedBuffer: []move{
+				{src: 0, dst: 6, length: 4},
+				{src: 4, dst: 10, length: 2},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			storage := &memoryStorage{data: []byte(c.givenData)}
+			buf := make([]byte, 3)
+			buffered := make([]move, 0)
+			literals := make([]segment, 0)
+
+			err := scheduleMoves(c.givenMoves, c.givenMaxLength, func(m move) error {
+				return copyWithin(storage, m, buf)
+			}, func(m move) error {
+				data := make([]byte, m.length)
+				_, err := storage.ReadAt(data, m.src)
+				buffered = append(buffered, m)
+				literals = append(literals, segment{offset: m.dst, data: data})
+				return err
+			})
+			assert.NoError(t, err)
+			for _, s := range literals {
+				storage.WriteAt(s.data, s.offset)
+			}
+
+			assert.Equal(t, c.expected, string(storage.data))
+			if c.expectedBuffer == nil {
+				c.expectedBuffer = []move{}
+			}
+			assert.Equal(t, c.expectedBuffer, buffered)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package rolling_hash_diff
+
+import (
+	"context"
+	"io"
+)
+
+// ApplyWithInverse writes to w updated data like Apply and to inverse encoded delta reconstructing original data
+// from updated data, both in the same pass over original data
+func ApplyWithInverse(w, inverse io.Writer, original io.Reader, originSignature Signature, delta Delta, opts ...Option) error {
+	return ApplyWithInverseContext(context.Background(), w, inverse, original, originSignature, delta, opts...)
+}
+
+// ApplyWithInverseContext writes to w updated data like ApplyContext and to inverse encoded delta reconstructing
+// original data from updated data, both in the same pass over original data.
+// Inverse delta is calculated against signature of updated data with chunk size of origin signature,
+// e.g. returned by SignatureFromReader(updated, originSignature.ChunkSize).
+// Original chunks kept at chunk aligned offsets of updated data are copied, other original data is added.
+// Inverse delta is complete only if nil error is returned.
+func ApplyWithInverseContext(ctx context.Context, w, inverse io.Writer, original io.Reader, originSignature Signature, delta Delta, opts ...Option) error {
+	if originSignature.ChunkSize <= 0 {
+		return ErrCalculateSignatureInvalidChunkSize
+	}
+	encoder, err := newDeltaEncoder(inverse)
+	if err != nil {
+		return err
+	}
+	return apply(ctx, w, original, originSignature, delta, newInverseWriter(encoder, originSignature.ChunkSize), opts)
+}
+
+// inverseWriter writes operations of inverse delta while original chunks are applied
+type inverseWriter struct {
+	encoder   *deltaEncoder
+	chunkSize int64
+	checksum  HashCalculator
+
+	// offset of updated data written so far
+	offset int64
+	// index of last updated chunk copied by inverse delta
+	lastIndex int
+	// last original chunk shorter than chunk size, it can be copied only if it ends updated data
+	tail       []byte
+	tailOffset int64
+}
+
+func newInverseWriter(encoder *deltaEncoder, chunkSize int) *inverseWriter {
+	return &inverseWriter{
+		encoder:   encoder,
+		chunkSize: int64(chunkSize),
+		checksum:  NewChecksumCalculator(),
+		lastIndex: -1,
+	}
+}
+
+// skips updated data which isn't part of original data
+func (i *inverseWriter) skip(n int) {
+	i.offset += int64(n)
+}
+
+// handles original chunk, kept chunks were written to updated data at current offset
+func (i *inverseWriter) chunk(data []byte, kept bool) error {
+	i.checksum.Write(data)
+	if !kept {
+		return i.add(data)
+	}
+
+	offset := i.offset
+	i.offset += int64(len(data))
+	if offset%i.chunkSize != 0 {
+		return i.add(data)
+	}
+	if int64(len(data)) < i.chunkSize {
+		i.tail = append([]byte{}, data...)
+		i.tailOffset = offset
+		return nil
+	}
+	return i.copyChunk(int(offset / i.chunkSize))
+}
+
+// writes remaining operations and checksum of original data
+func (i *inverseWriter) finish() error {
+	if i.tail != nil {
+		if i.tailOffset+int64(len(i.tail)) == i.offset {
+			if err := i.copyChunk(int(i.tailOffset / i.chunkSize)); err != nil {
+				return err
+			}
+		} else if err := i.add(i.tail); err != nil {
+			return err
+		}
+	}
+
+	chunksCount := int((i.offset + i.chunkSize - 1) / i.chunkSize)
+	if err := i.deleteUntil(chunksCount); err != nil {
+		return err
+	}
+	return i.encoder.writeEnd(i.checksum.Sum(nil))
+}
+
+// adds original data after last copied chunk, each original chunk is written as separate operation
+// so inverse delta isn't kept in memory
+func (i *inverseWriter) add(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return i.encoder.writeOperation(DeltaOperation{
+		Type:       OperationTypeAddition,
+		ChunkIndex: i.lastIndex + 1,
+		Data:       data,
+	})
+}
+
+func (i *inverseWriter) copyChunk(index int) error {
+	if err := i.deleteUntil(index); err != nil {
+		return err
+	}
+	i.lastIndex = index
+	return nil
+}
+
+// deletes updated chunks between last copied chunk and given index
+func (i *inverseWriter) deleteUntil(index int) error {
+	for j := i.lastIndex + 1; j < index; j++ {
+		if err := i.encoder.writeOperation(DeltaOperation{
+			Type:       OperationTypeDeletion,
+			ChunkIndex: j,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
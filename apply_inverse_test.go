@@ -0,0 +1,138 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyWithInverse(t *testing.T) {
+	cases := map[string]struct {
+		givenOriginal   string
+		givenUpdated    string
+		expectedInverse []DeltaOperation
+	}{
+		"equal data": {
+			givenOriginal:   "AAAABBBBCC",
+			givenUpdated:    "AAAABBBBCC",
+			expectedInverse: []DeltaOperation{},
+		},
+		"chunk changed": {
+			givenOriginal: "AAAABBBBCCCC",
+			givenUpdated:  "AAAAXXXXCCCC",
+			expectedInverse: []DeltaOperation{
+				{Type: OperationTypeAddition, ChunkIndex: 1, Data: []byte("BBBB")},
+				{Type: OperationTypeDeletion, ChunkIndex: 1},
+			},
+		},
+		"chunks added and deleted": {
+			givenOriginal: "AAAABBBBCCCCDD",
+			givenUpdated:  "XXXXAAAACCCCDD",
+			expectedInverse: []DeltaOperation{
+				{Type: OperationTypeDeletion, ChunkIndex: 0},
+				{Type: OperationTypeAddition, ChunkIndex: 2, Data: []byte("BBBB")},
+			},
+		},
+		"kept chunks shifted": {
+			givenOriginal: "AAAABBBBCC",
+			givenUpdated:  "XXAAAABBBBCCYY",
+			expectedInverse: []DeltaOperation{
+				{Type: OperationTypeAddition, ChunkIndex: 0, Data: []byte("AAAA")},
+				{Type: OperationTypeAddition, ChunkIndex: 0, Data: []byte("BBBB")},
+				{Type: OperationTypeAddition, ChunkIndex: 0, Data: []byte("CC")},
+				{Type: OperationTypeDeletion, ChunkIndex: 0},
+				{Type: OperationTypeDeletion, ChunkIndex: 1},
+				{Type: OperationTypeDeletion, ChunkIndex: 2},
+				{Type: OperationTypeDeletion, ChunkIndex: 3},
+			},
+		},
+		"last chunk followed by added data": {
+			givenOriginal: "AAAABB",
+			givenUpdated:  "AAAABBXX",
+			expectedInverse: []DeltaOperation{
+				{Type: OperationTypeAddition, ChunkIndex: 1, Data: []byte("BB")},
+				{Type: OperationTypeDeletion, ChunkIndex: 1},
+			},
+		},
+		"all data deleted": {
+			givenOriginal: "AAAABB",
+			givenUpdated:  "",
+			expectedInverse: []DeltaOperation{
+				{Type: OperationTypeAddition, ChunkIndex: 0, Data: []byte("AAAA")},
+				{Type: OperationTypeAddition, ChunkIndex: 0, Data: []byte("BB")},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			originSignature, err := SignatureFromReader(bytes.NewReader([]byte(c.givenOriginal)), 4)
+			assert.NoError(t, err)
+			delta, err := DeltaFromReader(bytes.NewReader([]byte(c.givenUpdated)), originSignature)
+			assert.NoError(t, err)
+
+			updated := &bytes.Buffer{}
+			encodedInverse := &bytes.Buffer{}
+			err = ApplyWithInverse(updated, encodedInverse, bytes.NewReader([]byte(c.givenOriginal)), originSignature, delta)
+			assert.NoError(t, err)
+			assert.Equal(t, c.givenUpdated, updated.String())
+
+			inverse, err := ReadDelta(encodedInverse)
+			assert.NoError(t, err)
+			expectedChecksum := sha256.Sum256([]byte(c.givenOriginal))
+			assert.Equal(t, Delta{Operations: c.expectedInverse, Checksum: expectedChecksum[:]}, inverse)
+
+			updatedSignature, err := SignatureFromReader(bytes.NewReader(updated.Bytes()), 4, WithSmallInput())
+			assert.NoError(t, err)
+			original := &bytes.Buffer{}
+			assert.NoError(t, Apply(original, bytes.NewReader(updated.Bytes()), updatedSignature, inverse))
+			assert.Equal(t, c.givenOriginal, original.String())
+		})
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestApplyWithInverse_Err(t *testing.T) {
+	original := []byte("AAAABBBBCCCC")
+	signature, err := SignatureFromReader(bytes.NewReader(original), 4)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader([]byte("AAAAXXXXCCCC")), signature)
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		givenDelta  Delta
+		expectedErr error
+	}{
+		"checksum mismatch": {
+			givenDelta:  Delta{Operations: delta.Operations, Checksum: []byte("invalid")},
+			expectedErr: ErrApplyChecksumMismatch,
+		},
+		"invalid delta": {
+			givenDelta:  Delta{Operations: []DeltaOperation{{Type: OperationTypeDeletion, ChunkIndex: 3}}},
+			expectedErr: ErrApplyInvalidDelta,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			encodedInverse := &bytes.Buffer{}
+			err := ApplyWithInverse(&bytes.Buffer{}, encodedInverse, bytes.NewReader(original), signature, c.givenDelta)
+			assert.Equal(t, c.expectedErr, err)
+
+			// inverse delta without end record can't be decoded
+			_, err = ReadDelta(encodedInverse)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("inverse write error", func(t *testing.T) {
+		err := ApplyWithInverse(&bytes.Buffer{}, failingWriter{}, bytes.NewReader(original), signature, delta)
+		assert.EqualError(t, err, "write failed")
+	})
+}
@@ -0,0 +1,121 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	cases := map[string]struct {
+		givenOriginal []byte
+		givenUpdated  []byte
+	}{
+		"equal data": {
+			givenOriginal: []byte("AAAABBBBCCCCDD"),
+			givenUpdated:  []byte("AAAABBBBCCCCDD"),
+		},
+		"prefix added, suffix deleted": {
+			givenOriginal: []byte("AAAABBBBCCCCDD"),
+			givenUpdated:  []byte("XXXXAAAABBBB"),
+		},
+		"inner added and deleted": {
+			givenOriginal: []byte("AAAABBBBCCCCDD"),
+			givenUpdated:  []byte("AAAAXXXXYYCCCCDD"),
+		},
+		"suffix added after last partial chunk": {
+			givenOriginal: []byte("AAAABBBBCC"),
+			givenUpdated:  []byte("AAAABBBBCCCCXXXXZ"),
+		},
+		"completely mismatched": {
+			givenOriginal: []byte("AAAABBBBCC"),
+			givenUpdated:  []byte("XYZ"),
+		},
+		"empty updated": {
+			givenOriginal: []byte("AAAABBBBCC"),
+			givenUpdated:  []byte{},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			signature, err := SignatureFromReader(bytes.NewReader(c.givenOriginal), 4)
+			assert.NoError(t, err)
+			delta, err := DeltaFromReader(bytes.NewReader(c.givenUpdated), signature)
+			assert.NoError(t, err)
+
+			actual := &bytes.Buffer{}
+			err = Apply(actual, bytes.NewReader(c.givenOriginal), signature, delta)
+
+			assert.NoError(t, err)
+			assert.Equal(t, string(c.givenUpdated), actual.String())
+		})
+	}
+}
+
+func TestApply_Err(t *testing.T) {
+	signature := Signature{
+		ChunkSize:    2,
+		ChunksHashes: [][]byte{{1}, {2}, {3}},
+	}
+
+	cases := map[string]struct {
+		givenCtx      func() context.Context
+		givenOriginal []byte
+		givenDelta    Delta
+		expectedErr   error
+	}{
+		"err deletion out of range": {
+			givenCtx:      context.Background,
+			givenOriginal: []byte{1, 1, 2, 2, 3},
+			givenDelta: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 3},
+				},
+			},
+			expectedErr: ErrApplyInvalidDelta,
+		},
+		"err addition out of range": {
+			givenCtx:      context.Background,
+			givenOriginal: []byte{1, 1, 2, 2, 3},
+			givenDelta: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeAddition, ChunkIndex: 4, Data: []byte{1}},
+				},
+			},
+			expectedErr: ErrApplyInvalidDelta,
+		},
+		"err original shorter than signature": {
+			givenCtx:      context.Background,
+			givenOriginal: []byte{1, 1, 2},
+			givenDelta:    Delta{},
+			expectedErr:   ErrApplyInvalidOriginal,
+		},
+		"err checksum mismatch": {
+			givenCtx:      context.Background,
+			givenOriginal: []byte{1, 1, 2, 2, 3},
+			givenDelta: Delta{
+				Checksum: []byte{1, 2, 3},
+			},
+			expectedErr: ErrApplyChecksumMismatch,
+		},
+		"err context canceled": {
+			givenCtx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			givenOriginal: []byte{1, 1, 2, 2, 3},
+			givenDelta:    Delta{},
+			expectedErr:   context.Canceled,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := ApplyContext(c.givenCtx(), &bytes.Buffer{}, bytes.NewReader(c.givenOriginal), signature, c.givenDelta)
+
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
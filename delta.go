@@ -1,12 +1,14 @@
 package rolling_hash_diff
 
 import (
-	"bytes"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
 )
 
 // Delta is description of diff between original and updated data
 type Delta struct {
 	Operations []DeltaOperation
+	// Checksum of whole updated data, it's verified by Apply if it's not empty
+	Checksum []byte
 }
 
 // Delta operation describes one peace of change needed to transform original data into updated data
@@ -25,43 +27,69 @@ const (
 )
 
 type DeltaCalculator struct {
-	origin         Signature
+	origin         originChunks
 	hashCalculator HashCalculator
+	checksum       HashCalculator
 
 	operations             []DeltaOperation
 	operationData          []byte
 	chunkData              []byte
 	lastMatchingChunkIndex int
+	progress               progressReporter
 }
 
-func NewDeltaCalculator(originSignature Signature) DeltaCalculator {
-	return newDeltaCalculator(originSignature, defaultHashCalculator)
+func NewDeltaCalculator(originSignature Signature, opts ...Option) DeltaCalculator {
+	return NewDeltaCalculatorFromIndex(NewSignatureIndex(originSignature), opts...)
 }
 
-func newDeltaCalculator(originSignature Signature, hashCalc HashCalculator) DeltaCalculator {
+// NewDeltaCalculatorFromIndex returns calculator using prebuilt index of origin signature,
+// the index can be shared by many calculators
+func NewDeltaCalculatorFromIndex(originIndex *SignatureIndex, opts ...Option) DeltaCalculator {
+	return newDeltaCalculator(originIndex, newDefaultHashCalculator(), opts...)
+}
+
+// NewDeltaCalculatorFromStream returns calculator using signature which is still being received,
+// the signature must be fed from other goroutine because calculator waits for chunks not received yet
+func NewDeltaCalculatorFromStream(originSignature *StreamingSignature, opts ...Option) DeltaCalculator {
+	return newDeltaCalculator(originSignature, newDefaultHashCalculator(), opts...)
+}
+
+func newDeltaCalculator(origin originChunks, hashCalc HashCalculator, opts ...Option) DeltaCalculator {
 	return DeltaCalculator{
-		origin:         originSignature,
+		origin:         origin,
 		hashCalculator: hashCalc,
+		checksum:       NewChecksumCalculator(),
 
 		operations:             make([]DeltaOperation, 0),
 		operationData:          make([]byte, 0),
 		chunkData:              make([]byte, 0),
 		lastMatchingChunkIndex: -1,
+		progress:               newProgressReporter(newOptions(opts)),
 	}
 }
 
 func (d *DeltaCalculator) Write(data []byte) (int, error) {
+	if _, err := d.checksum.Write(data); err != nil {
+		return 0, err
+	}
+
 	fromIndex := 0
 	for {
 		// if reached end of origin chunk just append data to operationData
-		if d.lastMatchingChunkIndex+1 >= len(d.origin.ChunksHashes) {
+		hasChunk, err := d.origin.hasChunk(d.lastMatchingChunkIndex + 1)
+		if err != nil {
+			return 0, err
+		}
+		if !hasChunk {
 			d.operationData = append(d.operationData, data[fromIndex:]...)
+			d.progress.addBytes(len(data) - fromIndex)
+			d.progress.report()
 			return len(data), nil
 		}
 
 		currentChunkSize := len(d.chunkData)
-		maxChunkPartSize := d.origin.ChunkSize - currentChunkSize
-		toIndex := min(fromIndex+maxChunkPartSize, len(data))
+		maxChunkPartSize := d.origin.ChunkSize() - currentChunkSize
+		toIndex := mathx.Min(fromIndex+maxChunkPartSize, len(data))
 
 		chunkPart := data[fromIndex:toIndex]
 		if _, err := d.hashCalculator.Write(chunkPart); err != nil {
@@ -70,10 +98,13 @@ func (d *DeltaCalculator) Write(data []byte) (int, error) {
 
 		chunkPartSize := toIndex - fromIndex
 		currentChunkSize += chunkPartSize
+		d.progress.addBytes(chunkPartSize)
 
 		d.chunkData = append(d.chunkData, chunkPart...)
-		if currentChunkSize == d.origin.ChunkSize {
-			d.calculateDeltaOperation(d.chunkData)
+		if currentChunkSize == d.origin.ChunkSize() {
+			if err := d.calculateDeltaOperation(d.chunkData); err != nil {
+				return 0, err
+			}
 			d.chunkData = make([]byte, 0)
 		}
 
@@ -88,10 +119,17 @@ func (d *DeltaCalculator) Write(data []byte) (int, error) {
 // Returns calculated delta for written data, it's not safe to reuse DeltaCalculator after call this method
 func (d *DeltaCalculator) Delta() (Delta, error) {
 	if len(d.chunkData) > 0 {
-		d.calculateDeltaOperation(d.chunkData)
+		if err := d.calculateDeltaOperation(d.chunkData); err != nil {
+			return Delta{}, err
+		}
 	}
+	d.progress.finish()
 
-	for i := d.lastMatchingChunkIndex + 1; i < len(d.origin.ChunksHashes); i++ {
+	chunksCount, err := d.origin.totalChunks()
+	if err != nil {
+		return Delta{}, err
+	}
+	for i := d.lastMatchingChunkIndex + 1; i < chunksCount; i++ {
 		d.operations = append(d.operations, DeltaOperation{
 			Type:       OperationTypeDeletion,
 			ChunkIndex: i,
@@ -108,19 +146,26 @@ func (d *DeltaCalculator) Delta() (Delta, error) {
 
 	return Delta{
 		Operations: d.operations,
+		Checksum:   d.checksum.Sum(nil),
 	}, nil
 }
 
-func (d *DeltaCalculator) calculateDeltaOperation(chunkData []byte) {
+func (d *DeltaCalculator) calculateDeltaOperation(chunkData []byte) error {
 	hash := d.hashCalculator.Sum(nil)
 	d.hashCalculator.Reset()
+	d.progress.addChunkHashed()
+	defer d.progress.report()
 
-	matchingIndex := d.nextMatchingChunkIndex(hash)
+	matchingIndex, err := d.origin.nextChunkIndex(hash, d.lastMatchingChunkIndex)
+	if err != nil {
+		return err
+	}
 	// not found matching chunk
 	if matchingIndex == -1 {
 		d.operationData = append(d.operationData, chunkData...)
-		return
+		return nil
 	}
+	d.progress.addChunkMatched()
 
 	// found matching chunk
 	// delete operations for not matching chunks between last and current found matching index
@@ -141,15 +186,16 @@ func (d *DeltaCalculator) calculateDeltaOperation(chunkData []byte) {
 	}
 
 	d.lastMatchingChunkIndex = matchingIndex
+	return nil
 }
 
-// returns matching origin chunk index or -1 if not found, starting after lastMatchingChunkIndex
-func (d *DeltaCalculator) nextMatchingChunkIndex(expectedHash []byte) int {
-	for i := d.lastMatchingChunkIndex + 1; i < len(d.origin.ChunksHashes); i++ {
-		hash := d.origin.ChunksHashes[i]
-		if bytes.Compare(expectedHash, hash) == 0 {
-			return i
-		}
-	}
-	return -1
+// originChunks provides origin chunks to DeltaCalculator
+type originChunks interface {
+	ChunkSize() int
+	// returns index of first chunk after given index having given hash or -1 if not found
+	nextChunkIndex(hash []byte, after int) (int, error)
+	// returns true if chunk with given index exists
+	hasChunk(index int) (bool, error)
+	// returns number of all chunks
+	totalChunks() (int, error)
 }
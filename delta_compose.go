@@ -0,0 +1,184 @@
+package rolling_hash_diff
+
+import (
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/iox"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+var (
+	ErrComposeDeltasEmpty            = errors.New("no deltas to compose")
+	ErrComposeDeltasMismatch         = errors.New("delta origin signature doesn't match data of previous delta")
+	ErrComposeDeltasOriginalRequired = errors.New("original data is required to compose deltas")
+)
+
+// DeltaStep is delta with signature of data it was calculated against
+type DeltaStep struct {
+	OriginSignature Signature
+	Delta           Delta
+}
+
+// ComposeDeltas squashes chain of deltas into single delta against origin signature of the first step,
+// signatures of following steps describe data produced by previous ones.
+// Composed delta copies original chunks which are kept whole and in order, other parts of original data
+// are added as literal data read from original. Original can be nil if no such parts are needed.
+func ComposeDeltas(original io.ReaderAt, steps ...DeltaStep) (Delta, error) {
+	if len(steps) == 0 {
+		return Delta{}, ErrComposeDeltasEmpty
+	}
+
+	first := steps[0].OriginSignature
+	segments, err := deltaLayout(first, steps[0].Delta)
+	if err != nil {
+		return Delta{}, err
+	}
+	pieces := make([]piece, 0, len(segments))
+	for _, s := range segments {
+		if s.isCopy() {
+			pieces = appendPiece(pieces, piece{src: int64(s.chunkIndex) * int64(first.ChunkSize), length: s.length})
+			continue
+		}
+		pieces = appendPiece(pieces, piece{src: -1, length: s.length, data: s.data})
+	}
+
+	for _, step := range steps[1:] {
+		if piecesSize(pieces) != step.OriginSignature.Size {
+			return Delta{}, ErrComposeDeltasMismatch
+		}
+		segments, err := deltaLayout(step.OriginSignature, step.Delta)
+		if err != nil {
+			return Delta{}, err
+		}
+		pieces = composePieces(pieces, step.OriginSignature, segments)
+	}
+
+	return piecesDelta(original, first, pieces, steps[len(steps)-1].Delta.Checksum)
+}
+
+// piece of composed data, range of original data or literal data
+type piece struct {
+	// offset in original data or -1 for literal data
+	src    int64
+	length int64
+	data   []byte
+}
+
+// appends piece merging it with previous one if both are continuous ranges of original data
+func appendPiece(pieces []piece, p piece) []piece {
+	if p.length == 0 {
+		return pieces
+	}
+	if n := len(pieces); n > 0 && p.src >= 0 && pieces[n-1].src >= 0 && pieces[n-1].src+pieces[n-1].length == p.src {
+		pieces[n-1].length += p.length
+		return pieces
+	}
+	return append(pieces, p)
+}
+
+func piecesSize(pieces []piece) int64 {
+	size := int64(0)
+	for _, p := range pieces {
+		size += p.length
+	}
+	return size
+}
+
+// returns pieces of data described by segments of delta against data made of given pieces
+func composePieces(pieces []piece, signature Signature, segments []segment) []piece {
+	offsets := make([]int64, len(pieces))
+	offset := int64(0)
+	for i, p := range pieces {
+		offsets[i] = offset
+		offset += p.length
+	}
+
+	composed := make([]piece, 0, len(segments))
+	for _, s := range segments {
+		if !s.isCopy() {
+			composed = appendPiece(composed, piece{src: -1, length: s.length, data: s.data})
+			continue
+		}
+
+		start := int64(s.chunkIndex) * int64(signature.ChunkSize)
+		end := start + s.length
+		// index of piece containing start of copied range
+		i := sort.Search(len(offsets), func(i int) bool { return offsets[i] > start }) - 1
+		for ; i < len(pieces) && offsets[i] < end; i++ {
+			from := mathx.MaxInt64(start, offsets[i]) - offsets[i]
+			to := mathx.MinInt64(end, offsets[i]+pieces[i].length) - offsets[i]
+			p := pieces[i]
+			if p.src >= 0 {
+				composed = appendPiece(composed, piece{src: p.src + from, length: to - from})
+				continue
+			}
+			composed = appendPiece(composed, piece{src: -1, length: to - from, data: p.data[from:to]})
+		}
+	}
+	return composed
+}
+
+// returns delta against original signature producing data made of pieces
+func piecesDelta(original io.ReaderAt, signature Signature, pieces []piece, checksum []byte) (Delta, error) {
+	chunkSize := int64(signature.ChunkSize)
+	chunksCount := len(signature.ChunksHashes)
+
+	operations := make([]DeltaOperation, 0)
+	lastIndex := -1
+	var data []byte
+	copyChunk := func(index int) {
+		for i := lastIndex + 1; i < index; i++ {
+			operations = append(operations, DeltaOperation{
+				Type:       OperationTypeDeletion,
+				ChunkIndex: i,
+			})
+		}
+		if len(data) > 0 {
+			operations = append(operations, DeltaOperation{
+				Type:       OperationTypeAddition,
+				ChunkIndex: lastIndex + 1,
+				Data:       data,
+			})
+			data = nil
+		}
+		lastIndex = index
+	}
+
+	for _, p := range pieces {
+		if p.src < 0 {
+			data = append(data, p.data...)
+			continue
+		}
+
+		for offset, end := p.src, p.src+p.length; offset < end; {
+			index := int(offset / chunkSize)
+			chunkStart := int64(index) * chunkSize
+			chunkEnd := chunkStart + chunkLength(signature, index)
+			// whole chunk following last copied one can be copied, other original data has to be added
+			if offset == chunkStart && end >= chunkEnd && index > lastIndex {
+				copyChunk(index)
+				offset = chunkEnd
+				continue
+			}
+
+			if original == nil {
+				return Delta{}, ErrComposeDeltasOriginalRequired
+			}
+			length := mathx.MinInt64(end, chunkEnd) - offset
+			buf := make([]byte, length)
+			if err := iox.ReadFullAt(original, buf, offset); err != nil {
+				return Delta{}, err
+			}
+			data = append(data, buf...)
+			offset += length
+		}
+	}
+	copyChunk(chunksCount)
+
+	return Delta{
+		Operations: operations,
+		Checksum:   checksum,
+	}, nil
+}
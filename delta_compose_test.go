@@ -0,0 +1,156 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComposeDeltas(t *testing.T) {
+	cases := map[string]struct {
+		givenVersions   []string
+		givenChunkSizes []int
+		givenOriginal   bool
+		expected        *Delta
+		expectedErr     error
+	}{
+		"single step": {
+			givenVersions:   []string{"AAAABBBBCCCC", "AAAAXXXXBBBBCCCC"},
+			givenChunkSizes: []int{4},
+			expected: &Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeAddition, ChunkIndex: 1, Data: []byte("XXXX")},
+				},
+			},
+		},
+		"chunks changed in following steps": {
+			givenVersions:   []string{"AAAABBBBCCCCDDDD", "AAAAXXXXCCCCDDDD", "AAAAXXXXCCCCYYYY", "AAAAXXXXZZZZCCCCYYYY"},
+			givenChunkSizes: []int{4, 4, 4},
+			expected: &Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 1},
+					{Type: OperationTypeAddition, ChunkIndex: 1, Data: []byte("XXXXZZZZ")},
+					{Type: OperationTypeDeletion, ChunkIndex: 3},
+					{Type: OperationTypeAddition, ChunkIndex: 3, Data: []byte("YYYY")},
+				},
+			},
+		},
+		"change reverted": {
+			givenVersions:   []string{"AAAABBBBCCCC", "AAAAXXXXCCCC", "AAAABBBBCCCC"},
+			givenChunkSizes: []int{4, 4},
+			// reverted data isn't known to be original data
+			expected: &Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 1},
+					{Type: OperationTypeAddition, ChunkIndex: 1, Data: []byte("BBBB")},
+				},
+			},
+		},
+		"different chunk sizes": {
+			givenVersions:   []string{"AAAABBBBCCCCDDDD", "AAAABBBBXXCCCCDDDD", "AAAABBBBXXCCCCDDDDYY"},
+			givenChunkSizes: []int{4, 2},
+			givenOriginal:   true,
+		},
+		"original chunks reordered": {
+			givenVersions:   []string{"AAAABBBBCCCCDDDD", "CCCCAAAABBBBDDDD", "CCCCAAAABBBBDDDDXX"},
+			givenChunkSizes: []int{4, 4},
+			givenOriginal:   true,
+		},
+		"shifted original chunks": {
+			givenVersions:   []string{"AAAABBBBCCCCDDDD", "XXAAAABBBBCCCCDDDD", "XXAAAABBBBCCCCDDDDYY"},
+			givenChunkSizes: []int{4, 4},
+			givenOriginal:   true,
+		},
+		"partial original chunk": {
+			givenVersions:   []string{"AAAABBBBCCCCDDDD", "AAAABBBBCCCCDDDD", "AABBBBCCCCDDDD"},
+			givenChunkSizes: []int{4, 2},
+			givenOriginal:   true,
+			expected: &Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 0},
+					{Type: OperationTypeAddition, ChunkIndex: 0, Data: []byte("AA")},
+				},
+			},
+		},
+		"partial original chunk without original": {
+			givenVersions:   []string{"AAAABBBBCCCCDDDD", "AAAABBBBCCCCDDDD", "AABBBBCCCCDDDD"},
+			givenChunkSizes: []int{4, 2},
+			expectedErr:     ErrComposeDeltasOriginalRequired,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			steps := make([]DeltaStep, len(c.givenChunkSizes))
+			for i, chunkSize := range c.givenChunkSizes {
+				signature, err := SignatureFromReader(bytes.NewReader([]byte(c.givenVersions[i])), chunkSize)
+				assert.NoError(t, err)
+				delta, err := DeltaFromReader(bytes.NewReader([]byte(c.givenVersions[i+1])), signature)
+				assert.NoError(t, err)
+				steps[i] = DeltaStep{OriginSignature: signature, Delta: delta}
+			}
+			original := []byte(c.givenVersions[0])
+			var originalReader io.ReaderAt
+			if c.givenOriginal {
+				originalReader = bytes.NewReader(original)
+			}
+
+			actual, err := ComposeDeltas(originalReader, steps...)
+			if c.expectedErr != nil {
+				assert.Equal(t, c.expectedErr, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			updated := []byte(c.givenVersions[len(c.givenVersions)-1])
+			if c.expected != nil {
+				expected := *c.expected
+				expectedChecksum := sha256.Sum256(updated)
+				expected.Checksum = expectedChecksum[:]
+				assert.Equal(t, expected, actual)
+			}
+
+			out := &bytes.Buffer{}
+			assert.NoError(t, Apply(out, bytes.NewReader(original), steps[0].OriginSignature, actual))
+			assert.Equal(t, string(updated), out.String())
+		})
+	}
+}
+
+func TestComposeDeltas_Err(t *testing.T) {
+	signature, err := SignatureFromReader(bytes.NewReader([]byte("AAAABBBB")), 4)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader([]byte("AAAABBBBCC")), signature)
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		givenSteps  []DeltaStep
+		expectedErr error
+	}{
+		"no steps": {
+			givenSteps:  []DeltaStep{},
+			expectedErr: ErrComposeDeltasEmpty,
+		},
+		"step against other data": {
+			givenSteps: []DeltaStep{
+				{OriginSignature: signature, Delta: delta},
+				{OriginSignature: signature, Delta: delta},
+			},
+			expectedErr: ErrComposeDeltasMismatch,
+		},
+		"invalid delta": {
+			givenSteps: []DeltaStep{
+				{OriginSignature: signature, Delta: Delta{Operations: []DeltaOperation{{Type: OperationTypeDeletion, ChunkIndex: 5}}}},
+			},
+			expectedErr: ErrApplyInvalidDelta,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ComposeDeltas(nil, c.givenSteps...)
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
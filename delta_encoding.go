@@ -0,0 +1,178 @@
+package rolling_hash_diff
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// Encoded delta starts with header: magic and format version, it's followed by operation records
+// and ends with record containing checksum of updated data
+var deltaMagic = []byte("RHDD")
+
+const (
+	deltaFormatVersion = 1
+
+	deltaRecordEnd      = 0
+	deltaRecordAddition = 1
+	deltaRecordDeletion = 2
+)
+
+var (
+	ErrDecodeDeltaInvalidFormat      = errors.New("invalid encoded delta format")
+	ErrDecodeDeltaUnsupportedVersion = errors.New("unsupported encoded delta version")
+)
+
+// WriteDelta writes encoded delta to w
+func WriteDelta(w io.Writer, delta Delta) error {
+	e, err := newDeltaEncoder(w)
+	if err != nil {
+		return err
+	}
+	for _, op := range delta.Operations {
+		if err := e.writeOperation(op); err != nil {
+			return err
+		}
+	}
+	return e.writeEnd(delta.Checksum)
+}
+
+// deltaEncoder writes encoded delta record by record, so delta doesn't have to be kept in memory
+type deltaEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// returns encoder which has already written header to w
+func newDeltaEncoder(w io.Writer) (*deltaEncoder, error) {
+	buf := make([]byte, 0, len(deltaMagic)+1)
+	buf = append(buf, deltaMagic...)
+	buf = append(buf, deltaFormatVersion)
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	return &deltaEncoder{
+		w:   w,
+		buf: buf,
+	}, nil
+}
+
+func (e *deltaEncoder) writeOperation(op DeltaOperation) error {
+	buf := e.buf[:0]
+	switch op.Type {
+	case OperationTypeAddition:
+		buf = append(buf, deltaRecordAddition)
+		buf = appendUvarint(buf, uint64(op.ChunkIndex))
+		buf = appendUvarint(buf, uint64(len(op.Data)))
+	case OperationTypeDeletion:
+		buf = append(buf, deltaRecordDeletion)
+		buf = appendUvarint(buf, uint64(op.ChunkIndex))
+	default:
+		return ErrApplyInvalidDelta
+	}
+	e.buf = buf
+	if _, err := e.w.Write(buf); err != nil {
+		return err
+	}
+	if op.Type != OperationTypeAddition {
+		return nil
+	}
+	_, err := e.w.Write(op.Data)
+	return err
+}
+
+// writes record ending encoded delta
+func (e *deltaEncoder) writeEnd(checksum []byte) error {
+	buf := append(e.buf[:0], deltaRecordEnd)
+	buf = appendUvarint(buf, uint64(len(checksum)))
+	buf = append(buf, checksum...)
+	e.buf = buf
+	_, err := e.w.Write(buf)
+	return err
+}
+
+// ReadDelta reads encoded delta from r, it doesn't read from r more than encoded delta
+func ReadDelta(r io.Reader) (Delta, error) {
+	br := byteReader{r: r}
+
+	header := make([]byte, len(deltaMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return Delta{}, decodeErr(err, ErrDecodeDeltaInvalidFormat)
+	}
+	if string(header[:len(deltaMagic)]) != string(deltaMagic) {
+		return Delta{}, ErrDecodeDeltaInvalidFormat
+	}
+	if header[len(deltaMagic)] != deltaFormatVersion {
+		return Delta{}, ErrDecodeDeltaUnsupportedVersion
+	}
+
+	operations := make([]DeltaOperation, 0)
+	for {
+		tag, err := br.ReadByte()
+		if err != nil {
+			return Delta{}, decodeErr(err, ErrDecodeDeltaInvalidFormat)
+		}
+
+		switch tag {
+		case deltaRecordEnd:
+			checksum, err := readBytes(br, maxHashSize)
+			if err != nil {
+				return Delta{}, err
+			}
+			return Delta{
+				Operations: operations,
+				Checksum:   checksum,
+			}, nil
+		case deltaRecordAddition:
+			index, err := binary.ReadUvarint(br)
+			if err != nil {
+				return Delta{}, decodeErr(err, ErrDecodeDeltaInvalidFormat)
+			}
+			data, err := readBytes(br, -1)
+			if err != nil {
+				return Delta{}, err
+			}
+			operations = append(operations, DeltaOperation{
+				Type:       OperationTypeAddition,
+				ChunkIndex: int(index),
+				Data:       data,
+			})
+		case deltaRecordDeletion:
+			index, err := binary.ReadUvarint(br)
+			if err != nil {
+				return Delta{}, decodeErr(err, ErrDecodeDeltaInvalidFormat)
+			}
+			operations = append(operations, DeltaOperation{
+				Type:       OperationTypeDeletion,
+				ChunkIndex: int(index),
+			})
+		default:
+			return Delta{}, ErrDecodeDeltaInvalidFormat
+		}
+	}
+}
+
+// reads length prefixed bytes, length greater than limit is invalid unless limit is negative
+func readBytes(r byteReader, limit int64) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, decodeErr(err, ErrDecodeDeltaInvalidFormat)
+	}
+	if limit >= 0 && n > uint64(limit) || n > 1<<62 {
+		return nil, ErrDecodeDeltaInvalidFormat
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	// data is read without allocating declared length upfront, so corrupted length can't exhaust memory
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != n {
+		return nil, ErrDecodeDeltaInvalidFormat
+	}
+	return data, nil
+}
@@ -0,0 +1,84 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDelta_ReadDelta(t *testing.T) {
+	cases := map[string]struct {
+		given Delta
+	}{
+		"additions and deletions": {
+			given: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 0},
+					{Type: OperationTypeAddition, ChunkIndex: 0, Data: []byte{1, 2, 3}},
+					{Type: OperationTypeDeletion, ChunkIndex: 300},
+					{Type: OperationTypeAddition, ChunkIndex: 301, Data: bytes.Repeat([]byte{7}, 1000)},
+				},
+				Checksum: bytes.Repeat([]byte{9}, 32),
+			},
+		},
+		"no operations, no checksum": {
+			given: Delta{
+				Operations: []DeltaOperation{},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			assert.NoError(t, WriteDelta(buf, c.given))
+			buf.WriteString("rest")
+
+			actual, err := ReadDelta(buf)
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.given, actual)
+			assert.Equal(t, "rest", buf.String())
+		})
+	}
+}
+
+func TestReadDelta_Err(t *testing.T) {
+	cases := map[string]struct {
+		given       []byte
+		expectedErr error
+	}{
+		"err empty": {
+			given:       []byte{},
+			expectedErr: ErrDecodeDeltaInvalidFormat,
+		},
+		"err invalid magic": {
+			given:       []byte("RHDS\x01\x00\x00"),
+			expectedErr: ErrDecodeDeltaInvalidFormat,
+		},
+		"err unsupported version": {
+			given:       []byte("RHDD\x09\x00\x00"),
+			expectedErr: ErrDecodeDeltaUnsupportedVersion,
+		},
+		"err addition data shorter than declared": {
+			given:       []byte("RHDD\x01\x01\x00\x05\x01\x02"),
+			expectedErr: ErrDecodeDeltaInvalidFormat,
+		},
+		"err missing end": {
+			given:       []byte("RHDD\x01\x02\x00"),
+			expectedErr: ErrDecodeDeltaInvalidFormat,
+		},
+		"err unknown record": {
+			given:       []byte("RHDD\x01\x05"),
+			expectedErr: ErrDecodeDeltaInvalidFormat,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := ReadDelta(bytes.NewReader(c.given))
+
+			assert.Equal(t, Delta{}, actual)
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
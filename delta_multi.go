@@ -0,0 +1,206 @@
+package rolling_hash_diff
+
+import (
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// MultiDeltaCalculator calculates delta against multi signature. Written data is matched with coarse chunks,
+// mismatched regions are matched again with finer chunks of origin chunks deleted in that region
+// once hashes of these chunks are passed to Refine. Calculated delta is related to the finest level refined so far.
+type MultiDeltaCalculator struct {
+	coarse    DeltaCalculator
+	chunkSize int
+	size      int64
+	delta     *Delta
+	// ranges of chunks requested by the last call of Mismatched
+	requested      []ChunkRange
+	requestedChunk int
+	err            error
+}
+
+func NewMultiDeltaCalculator(coarseSignature Signature) MultiDeltaCalculator {
+	return MultiDeltaCalculator{
+		coarse:    NewDeltaCalculator(coarseSignature),
+		chunkSize: coarseSignature.ChunkSize,
+		size:      coarseSignature.Size,
+	}
+}
+
+func (m *MultiDeltaCalculator) Write(data []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	return m.coarse.Write(data)
+}
+
+// Mismatched returns ranges of chunks with given chunk size covering origin chunks which weren't matched, hashes
+// of these ranges have to be passed to Refine. It must be called after all data is written and chunk size must be
+// a divisor of chunk size of the last level.
+func (m *MultiDeltaCalculator) Mismatched(chunkSize int) ([]ChunkRange, error) {
+	if err := m.finish(); err != nil {
+		return nil, err
+	}
+	if chunkSize <= 0 || chunkSize >= m.chunkSize || m.chunkSize%chunkSize != 0 {
+		return nil, ErrMultiSignatureInvalidLevels
+	}
+
+	fineIndex := m.fineIndexFunc(chunkSize)
+	ranges := make([]ChunkRange, 0)
+	forEachOperation(*m.delta, func(DeltaOperation) error {
+		return nil
+	}, func(from, to int, data []byte) error {
+		if data != nil {
+			ranges = append(ranges, ChunkRange{Start: fineIndex(from), End: fineIndex(to)})
+		}
+		return nil
+	})
+	m.requested = ranges
+	m.requestedChunk = chunkSize
+	return ranges, nil
+}
+
+// Refine matches mismatched regions again with chunks of level, which must hold hashes of ranges returned
+// by the last call of Mismatched
+func (m *MultiDeltaCalculator) Refine(level SignatureLevel) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.delta == nil || level.ChunkSize != m.requestedChunk || !equalChunkRanges(level.Ranges, m.requested) ||
+		len(level.ChunksHashes) != rangesLength(level.Ranges) {
+		return ErrMultiSignatureInvalidLevels
+	}
+
+	fineIndex := m.fineIndexFunc(level.ChunkSize)
+	hashes := level.ChunksHashes
+	operations := make([]DeltaOperation, 0, len(m.delta.Operations))
+	err := forEachOperation(*m.delta, func(op DeltaOperation) error {
+		op.ChunkIndex = fineIndex(op.ChunkIndex)
+		operations = append(operations, op)
+		return nil
+	}, func(from, to int, data []byte) error {
+		from, to = fineIndex(from), fineIndex(to)
+		if data == nil {
+			for i := from; i < to; i++ {
+				operations = append(operations, DeltaOperation{Type: OperationTypeDeletion, ChunkIndex: i})
+			}
+			return nil
+		}
+		regionOperations, err := matchRegion(data, level.ChunkSize, hashes[:to-from], from)
+		if err != nil {
+			return err
+		}
+		hashes = hashes[to-from:]
+		operations = append(operations, regionOperations...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.delta = &Delta{
+		Operations: operations,
+		Checksum:   m.delta.Checksum,
+	}
+	m.chunkSize = level.ChunkSize
+	m.requested = nil
+	m.requestedChunk = 0
+	return nil
+}
+
+// Returns calculated delta related to the finest level passed to Refine, it's not safe to write data after call
+// of this method
+func (m *MultiDeltaCalculator) Delta() (Delta, error) {
+	if err := m.finish(); err != nil {
+		return Delta{}, err
+	}
+	return *m.delta, nil
+}
+
+// calculates coarse delta if it isn't calculated yet
+func (m *MultiDeltaCalculator) finish() error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.delta != nil {
+		return nil
+	}
+	delta, err := m.coarse.Delta()
+	if err != nil {
+		m.err = err
+		return err
+	}
+	m.delta = &delta
+	return nil
+}
+
+// returns function converting index of chunk of the current level into index of chunk with given chunk size
+func (m *MultiDeltaCalculator) fineIndexFunc(chunkSize int) func(int) int {
+	ratio := m.chunkSize / chunkSize
+	fineChunksCount := chunksCount(m.size, chunkSize)
+	return func(index int) int {
+		return mathx.Min(index*ratio, fineChunksCount)
+	}
+}
+
+// calls region for every run of continuous deletions [from, to) with data added in their place, or nil data
+// if nothing is added there, other operations are passed to operation. The first error stops iteration.
+func forEachOperation(delta Delta, operation func(DeltaOperation) error, region func(from, to int, data []byte) error) error {
+	ops := delta.Operations
+	for i := 0; i < len(ops); i++ {
+		op := ops[i]
+		if op.Type != OperationTypeDeletion {
+			if err := operation(op); err != nil {
+				return err
+			}
+			continue
+		}
+
+		from, to := op.ChunkIndex, op.ChunkIndex+1
+		for i+1 < len(ops) && ops[i+1].Type == OperationTypeDeletion && ops[i+1].ChunkIndex == to {
+			to++
+			i++
+		}
+		var data []byte
+		if i+1 < len(ops) && ops[i+1].Type == OperationTypeAddition && ops[i+1].ChunkIndex == from {
+			data = ops[i+1].Data
+			i++
+		}
+		if err := region(from, to, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns operations transforming chunks with given hashes, starting at index from, into data
+func matchRegion(data []byte, chunkSize int, hashes [][]byte, from int) ([]DeltaOperation, error) {
+	region := Signature{
+		ChunkSize:    chunkSize,
+		ChunksHashes: hashes,
+	}
+	calc := NewDeltaCalculator(region)
+	if _, err := calc.Write(data); err != nil {
+		return nil, err
+	}
+	delta, err := calc.Delta()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range delta.Operations {
+		delta.Operations[i].ChunkIndex += from
+	}
+	return delta.Operations, nil
+}
+
+func equalChunkRanges(a, b []ChunkRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
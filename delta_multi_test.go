@@ -0,0 +1,216 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiDeltaCalculator_Delta(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEEEEFFFFGGGGHHHHIIIIJJJJKK")
+
+	cases := map[string]struct {
+		givenUpdated   []byte
+		expected       Delta
+		expectedRanges [][]ChunkRange
+	}{
+		"equal data": {
+			givenUpdated: original,
+			expected: Delta{
+				Operations: []DeltaOperation{},
+			},
+			expectedRanges: [][]ChunkRange{{}, {}},
+		},
+		"one fine chunk changed inside coarse chunk": {
+			givenUpdated: []byte("AAAABBBBCCCCDDDDEEEEXXXXGGGGHHHHIIIIJJJJKK"),
+			expected: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 5},
+					{Type: OperationTypeAddition, ChunkIndex: 5, Data: []byte("XXXX")},
+				},
+			},
+			// only chunks inside mismatched coarse chunk are fetched
+			expectedRanges: [][]ChunkRange{{{Start: 2, End: 4}}, {{Start: 4, End: 6}}},
+		},
+		"fine chunks added and deleted, last partial chunk": {
+			givenUpdated: []byte("AAAABBBBCCCCDDDDEEEEXXXXFFFFGGGGHHHHIIIIJJJJZZ"),
+			expected: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeAddition, ChunkIndex: 5, Data: []byte("XXXX")},
+					{Type: OperationTypeDeletion, ChunkIndex: 10},
+					{Type: OperationTypeAddition, ChunkIndex: 10, Data: []byte("ZZ")},
+				},
+			},
+			expectedRanges: [][]ChunkRange{{{Start: 2, End: 6}}, {{Start: 4, End: 11}}},
+		},
+		"coarse chunks deleted": {
+			givenUpdated: []byte("AAAABBBBCCCCDDDDIIIIJJJJKK"),
+			expected: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 4},
+					{Type: OperationTypeDeletion, ChunkIndex: 5},
+					{Type: OperationTypeDeletion, ChunkIndex: 6},
+					{Type: OperationTypeDeletion, ChunkIndex: 7},
+				},
+			},
+			// deleted chunks aren't matched, so their hashes aren't needed
+			expectedRanges: [][]ChunkRange{{}, {}},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			coarse, err := SignatureFromReader(bytes.NewReader(original), 16)
+			assert.NoError(t, err)
+			signature := MultiSignature{Coarse: coarse}
+
+			calc := NewMultiDeltaCalculator(coarse)
+			_, err = calc.Write(c.givenUpdated)
+			assert.NoError(t, err)
+			actualRanges := make([][]ChunkRange, 0)
+			for _, chunkSize := range []int{8, 4} {
+				ranges, err := calc.Mismatched(chunkSize)
+				assert.NoError(t, err)
+				actualRanges = append(actualRanges, ranges)
+
+				level, err := SignatureLevelFromReaderAt(bytes.NewReader(original), int64(len(original)), chunkSize, ranges)
+				assert.NoError(t, err)
+				assert.NoError(t, calc.Refine(level))
+				signature.Levels = append(signature.Levels, level)
+			}
+			actual, err := calc.Delta()
+
+			expected := c.expected
+			expectedChecksum := sha256.Sum256(c.givenUpdated)
+			expected.Checksum = expectedChecksum[:]
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+			assert.Equal(t, c.expectedRanges, actualRanges)
+
+			updated := &bytes.Buffer{}
+			assert.NoError(t, Apply(updated, bytes.NewReader(original), signature.Finest(), actual))
+			assert.Equal(t, string(c.givenUpdated), updated.String())
+		})
+	}
+}
+
+func TestMultiDeltaCalculator_Err(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEEEEFFFFGGGGHHHHIIIIJJJJKK")
+	updated := []byte("AAAABBBBCCCCDDDDEEEEXXXXGGGGHHHHIIIIJJJJKK")
+
+	cases := map[string]struct {
+		givenChunkSize int
+		givenLevel     func(ranges []ChunkRange) SignatureLevel
+		expectedErr    error
+	}{
+		"err chunk size not divisor": {
+			givenChunkSize: 5,
+			expectedErr:    ErrMultiSignatureInvalidLevels,
+		},
+		"err chunk size not smaller": {
+			givenChunkSize: 16,
+			expectedErr:    ErrMultiSignatureInvalidLevels,
+		},
+		"err zero chunk size": {
+			givenChunkSize: 0,
+			expectedErr:    ErrMultiSignatureInvalidLevels,
+		},
+		"err level with other ranges": {
+			givenChunkSize: 8,
+			givenLevel: func(ranges []ChunkRange) SignatureLevel {
+				level, _ := SignatureLevelFromReaderAt(bytes.NewReader(original), int64(len(original)), 8, []ChunkRange{{Start: 0, End: 2}})
+				return level
+			},
+			expectedErr: ErrMultiSignatureInvalidLevels,
+		},
+		"err level with other chunk size": {
+			givenChunkSize: 8,
+			givenLevel: func(ranges []ChunkRange) SignatureLevel {
+				level, _ := SignatureLevelFromReaderAt(bytes.NewReader(original), int64(len(original)), 4, ranges)
+				return level
+			},
+			expectedErr: ErrMultiSignatureInvalidLevels,
+		},
+		"err level without hashes": {
+			givenChunkSize: 8,
+			givenLevel: func(ranges []ChunkRange) SignatureLevel {
+				return SignatureLevel{ChunkSize: 8, Ranges: ranges}
+			},
+			expectedErr: ErrMultiSignatureInvalidLevels,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			coarse, err := SignatureFromReader(bytes.NewReader(original), 16)
+			assert.NoError(t, err)
+			calc := NewMultiDeltaCalculator(coarse)
+			_, err = calc.Write(updated)
+			assert.NoError(t, err)
+
+			ranges, err := calc.Mismatched(c.givenChunkSize)
+			if c.givenLevel != nil {
+				assert.NoError(t, err)
+				err = calc.Refine(c.givenLevel(ranges))
+			}
+
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
+
+func TestSignatureLevelFromReaderAt_Err(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDD")
+
+	cases := map[string]struct {
+		givenChunkSize int
+		givenRanges    []ChunkRange
+		expectedErr    error
+	}{
+		"err invalid chunk size": {
+			givenChunkSize: 0,
+			expectedErr:    ErrCalculateSignatureInvalidChunkSize,
+		},
+		"err range beyond data": {
+			givenChunkSize: 4,
+			givenRanges:    []ChunkRange{{Start: 2, End: 5}},
+			expectedErr:    ErrChunkRangesInvalid,
+		},
+		"err chunk size above limit": {
+			givenChunkSize: MaxChunkSize + 1,
+			expectedErr:    ErrChunkSizeAboveLimit,
+		},
+		"err empty range": {
+			givenChunkSize: 4,
+			givenRanges:    []ChunkRange{{Start: 1, End: 1}},
+			expectedErr:    ErrChunkRangesInvalid,
+		},
+		"err overlapping ranges": {
+			givenChunkSize: 4,
+			givenRanges:    []ChunkRange{{Start: 0, End: 2}, {Start: 1, End: 3}},
+			expectedErr:    ErrChunkRangesInvalid,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := SignatureLevelFromReaderAt(bytes.NewReader(original), int64(len(original)), c.givenChunkSize, c.givenRanges)
+
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
+
+func TestMultiSignature_Finest_ErrIncomplete(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEEEEFFFFGGGGHHHHIIIIJJJJKK")
+	coarse, err := SignatureFromReader(bytes.NewReader(original), 16)
+	assert.NoError(t, err)
+	level, err := SignatureLevelFromReaderAt(bytes.NewReader(original), int64(len(original)), 4, []ChunkRange{{Start: 4, End: 6}})
+	assert.NoError(t, err)
+	finest := MultiSignature{Coarse: coarse, Levels: []SignatureLevel{level}}.Finest()
+
+	_, err = UpdateSignature(finest, Delta{Operations: []DeltaOperation{}}, bytes.NewReader(original))
+	assert.Equal(t, ErrSignatureIncomplete, err)
+
+	_, err = CompareSignatures(finest, finest)
+	assert.Equal(t, ErrSignatureIncomplete, err)
+}
@@ -0,0 +1,203 @@
+package rolling_hash_diff
+
+import (
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/iox"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// ParallelDeltaCalculator calculates delta for updated data available through io.ReaderAt,
+// updated data is split into segments searched concurrently against origin signature,
+// segments results are stitched together so the delta is the same as calculated by DeltaCalculator.
+// Checksum of updated data isn't calculated unless it's enabled with SetChecksum.
+type ParallelDeltaCalculator struct {
+	origin            *SignatureIndex
+	workers           int
+	newHashCalculator func() HashCalculator
+	checksum          bool
+	options           options
+}
+
+// NewParallelDeltaCalculator returns calculator using given number of workers,
+// if workers is less than 1 number of available CPUs is used, progress is reported by workers as chunks are hashed
+func NewParallelDeltaCalculator(originSignature Signature, workers int, opts ...Option) ParallelDeltaCalculator {
+	return NewParallelDeltaCalculatorFromIndex(NewSignatureIndex(originSignature), workers, opts...)
+}
+
+// NewParallelDeltaCalculatorFromIndex returns calculator using prebuilt index of origin signature,
+// the index can be shared by many calculators
+func NewParallelDeltaCalculatorFromIndex(originIndex *SignatureIndex, workers int, opts ...Option) ParallelDeltaCalculator {
+	return newParallelDeltaCalculator(originIndex, workers, newDefaultHashCalculator, opts...)
+}
+
+func newParallelDeltaCalculator(originIndex *SignatureIndex, workers int, newHashCalc func() HashCalculator, opts ...Option) ParallelDeltaCalculator {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	return ParallelDeltaCalculator{
+		origin:            originIndex,
+		workers:           workers,
+		newHashCalculator: newHashCalc,
+		options:           newOptions(opts),
+	}
+}
+
+// SetChecksum enables checksum of updated data in calculated deltas, so Apply can verify them.
+// Checksum is calculated sequentially while segments are searched, so it limits delta calculation
+// to speed of hashing whole updated data by single CPU.
+func (p *ParallelDeltaCalculator) SetChecksum(enabled bool) {
+	p.checksum = enabled
+}
+
+// Delta calculates delta for first size bytes of r, it's safe to call this method concurrently
+func (p ParallelDeltaCalculator) Delta(r io.ReaderAt, size int64) (Delta, error) {
+	if p.origin.ChunkSize() <= 0 {
+		return Delta{}, ErrCalculateSignatureInvalidChunkSize
+	}
+
+	chunkSize := int64(p.origin.ChunkSize())
+	chunksCount := int((size + chunkSize - 1) / chunkSize)
+
+	// checksum of whole data is calculated sequentially while segments are searched
+	var checksum HashCalculator
+	checksumResult := make(chan error, 1)
+	if p.checksum {
+		checksum = NewChecksumCalculator()
+		go func() {
+			_, err := io.Copy(checksum, io.NewSectionReader(r, 0, size))
+			checksumResult <- err
+		}()
+	} else {
+		checksumResult <- nil
+	}
+
+	// matching origin chunks indexes for every chunk of updated data
+	candidates := make([][]int, chunksCount)
+	progress := newSharedProgressReporter(p.options)
+	err := p.searchSegments(r, size, candidates, progress)
+	if checksumErr := <-checksumResult; err == nil {
+		err = checksumErr
+	}
+	if err != nil {
+		return Delta{}, err
+	}
+
+	s := deltaStitcher{
+		r:                      r,
+		operations:             make([]DeltaOperation, 0),
+		lastMatchingChunkIndex: -1,
+	}
+	for i, indexes := range candidates {
+		matchingIndex := nextChunkIndex(indexes, s.lastMatchingChunkIndex)
+		if matchingIndex == -1 {
+			s.extendOperationData(int64(i)*chunkSize, mathx.Min(int(chunkSize), int(size-int64(i)*chunkSize)))
+			continue
+		}
+		if err := s.match(matchingIndex); err != nil {
+			return Delta{}, err
+		}
+		progress.addChunkMatched()
+	}
+	if err := s.match(p.origin.ChunksCount()); err != nil {
+		return Delta{}, err
+	}
+
+	delta := Delta{
+		Operations: s.operations,
+	}
+	if checksum != nil {
+		delta.Checksum = checksum.Sum(nil)
+	}
+	progress.finish()
+	return delta, nil
+}
+
+// hashes chunks of updated data in segments, every segment is processed by separate goroutine
+func (p ParallelDeltaCalculator) searchSegments(r io.ReaderAt, size int64, candidates [][]int, progress *sharedProgressReporter) error {
+	chunkSize := int64(p.origin.ChunkSize())
+	segmentChunks := (len(candidates) + p.workers - 1) / p.workers
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+	}
+	for from := 0; from < len(candidates); from += segmentChunks {
+		to := mathx.Min(from+segmentChunks, len(candidates))
+
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+
+			hashCalc := p.newHashCalculator()
+			buf := make([]byte, chunkSize)
+			for i := from; i < to; i++ {
+				offset := int64(i) * chunkSize
+				chunk := buf[:mathx.Min(int(chunkSize), int(size-offset))]
+				if err := iox.ReadFullAt(r, chunk, offset); err != nil {
+					fail(err)
+					return
+				}
+				if _, err := hashCalc.Write(chunk); err != nil {
+					fail(err)
+					return
+				}
+				candidates[i] = p.origin.lookup(hashCalc.Sum(nil))
+				hashCalc.Reset()
+				progress.addChunkHashed(len(chunk))
+			}
+		}(from, to)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// deltaStitcher builds delta operations from matches found in segments of updated data
+type deltaStitcher struct {
+	r io.ReaderAt
+
+	operations             []DeltaOperation
+	operationDataOffset    int64
+	operationDataSize      int
+	lastMatchingChunkIndex int
+}
+
+// extends not matched data since last matching by updated data chunk at given offset
+func (s *deltaStitcher) extendOperationData(offset int64, size int) {
+	if s.operationDataSize == 0 {
+		s.operationDataOffset = offset
+	}
+	s.operationDataSize += size
+}
+
+// adds operations for origin chunks and not matched data between last matching and given origin chunk index
+func (s *deltaStitcher) match(matchingIndex int) error {
+	for i := s.lastMatchingChunkIndex + 1; i < matchingIndex; i++ {
+		s.operations = append(s.operations, DeltaOperation{
+			Type:       OperationTypeDeletion,
+			ChunkIndex: i,
+		})
+	}
+	if s.operationDataSize > 0 {
+		data := make([]byte, s.operationDataSize)
+		if err := iox.ReadFullAt(s.r, data, s.operationDataOffset); err != nil {
+			return err
+		}
+		s.operations = append(s.operations, DeltaOperation{
+			Type:       OperationTypeAddition,
+			ChunkIndex: s.lastMatchingChunkIndex + 1,
+			Data:       data,
+		})
+		s.operationDataSize = 0
+	}
+
+	s.lastMatchingChunkIndex = matchingIndex
+	return nil
+}
@@ -0,0 +1,77 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelDeltaCalculator_Delta(t *testing.T) {
+	origin := []byte("AAAAABBBBBCCCCCDDDDDEEEEEFFFFFGGGGGHHHHHAAAAA")
+
+	cases := map[string]struct {
+		givenWorkers  int
+		givenData     []byte
+		givenChecksum bool
+	}{
+		"equal data": {
+			givenWorkers: 3,
+			givenData:    origin,
+		},
+		"inner added and deleted, one worker": {
+			givenWorkers: 1,
+			givenData:    []byte("AAAAAXXXXXBBBBBDDDDDEEEEEZZZZZFFFFFGGGGGHHHHHAAAAA"),
+		},
+		"inner added and deleted, many workers": {
+			givenWorkers: 4,
+			givenData:    []byte("AAAAAXXXXXBBBBBDDDDDEEEEEZZZZZFFFFFGGGGGHHHHHAAAAA"),
+		},
+		"inner added and deleted, with checksum": {
+			givenWorkers:  4,
+			givenData:     []byte("AAAAAXXXXXBBBBBDDDDDEEEEEZZZZZFFFFFGGGGGHHHHHAAAAA"),
+			givenChecksum: true,
+		},
+		"repeated chunks, segment boundaries inside changes": {
+			givenWorkers: 5,
+			givenData:    []byte("AAAAAAAAAAXXXXXCCCCCCCCCCYYYYYHHHHHAAAAAZZ"),
+		},
+		"completely mismatched": {
+			givenWorkers: 2,
+			givenData:    []byte("XXXXXYYYYYZZ"),
+		},
+		"more workers than chunks": {
+			givenWorkers: 32,
+			givenData:    []byte("BBBBBAAAAA"),
+		},
+		"empty data": {
+			givenWorkers: 2,
+			givenData:    []byte{},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			signatureCalc := NewSignatureCalculator(5)
+			_, err := signatureCalc.Write(origin)
+			assert.NoError(t, err)
+			signature, err := signatureCalc.Signature()
+			assert.NoError(t, err)
+
+			seq := NewDeltaCalculator(signature)
+			_, err = seq.Write(c.givenData)
+			assert.NoError(t, err)
+			expected, err := seq.Delta()
+			assert.NoError(t, err)
+			if !c.givenChecksum {
+				expected.Checksum = nil
+			}
+
+			p := NewParallelDeltaCalculator(signature, c.givenWorkers)
+			p.SetChecksum(c.givenChecksum)
+			actual, err := p.Delta(bytes.NewReader(c.givenData), int64(len(c.givenData)))
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
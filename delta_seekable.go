@@ -0,0 +1,247 @@
+package rolling_hash_diff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Encoded seekable delta starts with header: magic, format version, origin chunk size and size and checksum,
+// it's followed by index of segments of updated data in order and by literal data of all literal segments.
+// Index is small comparing to literal data, so reader can load it and fetch only literal data it needs.
+var seekableDeltaMagic = []byte("RHDX")
+
+const (
+	seekableDeltaFormatVersion = 1
+
+	seekableDeltaSegmentCopy    = 1
+	seekableDeltaSegmentLiteral = 2
+)
+
+var (
+	ErrDecodeSeekableDeltaInvalidFormat      = errors.New("invalid encoded seekable delta format")
+	ErrDecodeSeekableDeltaUnsupportedVersion = errors.New("unsupported encoded seekable delta version")
+)
+
+// WriteSeekableDelta writes delta calculated against origin signature in seekable format to w,
+// adjacent copied chunks are written as one segment
+func WriteSeekableDelta(w io.Writer, originSignature Signature, delta Delta) error {
+	segments, err := deltaLayout(originSignature, delta)
+	if err != nil {
+		return err
+	}
+	segments = mergeCopySegments(segments, int64(originSignature.ChunkSize))
+
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, 64)
+	buf = append(buf, seekableDeltaMagic...)
+	buf = append(buf, seekableDeltaFormatVersion)
+	buf = appendUvarint(buf, uint64(originSignature.ChunkSize))
+	buf = appendUvarint(buf, uint64(originSignature.Size))
+	buf = appendUvarint(buf, uint64(len(delta.Checksum)))
+	buf = append(buf, delta.Checksum...)
+	buf = appendUvarint(buf, uint64(len(segments)))
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+
+	for _, s := range segments {
+		buf = buf[:0]
+		if s.isCopy() {
+			buf = append(buf, seekableDeltaSegmentCopy)
+			buf = appendUvarint(buf, uint64(s.chunkIndex))
+		} else {
+			buf = append(buf, seekableDeltaSegmentLiteral)
+		}
+		buf = appendUvarint(buf, uint64(s.length))
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	for _, s := range segments {
+		if s.isCopy() {
+			continue
+		}
+		if _, err := bw.Write(s.data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// SeekableDelta is delta encoded in seekable format, only its index is kept in memory
+type SeekableDelta struct {
+	r         io.ReaderAt
+	chunkSize int
+	segments  []segment
+	size      int64
+	checksum  []byte
+}
+
+// OpenSeekableDelta reads index of seekable delta from r, literal data is read from r on demand.
+// Reads of r are buffered, so it can be remote, e.g. read with HTTP Range requests.
+func OpenSeekableDelta(r io.ReaderAt) (*SeekableDelta, error) {
+	cr := &countingReader{r: bufio.NewReader(io.NewSectionReader(r, 0, 1<<62))}
+
+	header := make([]byte, len(seekableDeltaMagic)+1)
+	if _, err := io.ReadFull(cr, header); err != nil {
+		return nil, decodeErr(err, ErrDecodeSeekableDeltaInvalidFormat)
+	}
+	if string(header[:len(seekableDeltaMagic)]) != string(seekableDeltaMagic) {
+		return nil, ErrDecodeSeekableDeltaInvalidFormat
+	}
+	if header[len(seekableDeltaMagic)] != seekableDeltaFormatVersion {
+		return nil, ErrDecodeSeekableDeltaUnsupportedVersion
+	}
+
+	values := make([]uint64, 3)
+	for i := range values {
+		v, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return nil, decodeErr(err, ErrDecodeSeekableDeltaInvalidFormat)
+		}
+		values[i] = v
+	}
+	chunkSize, originSize, checksumLength := values[0], values[1], values[2]
+	if chunkSize == 0 || chunkSize > 1<<31 || originSize > 1<<62 || checksumLength > maxHashSize {
+		return nil, ErrDecodeSeekableDeltaInvalidFormat
+	}
+	checksum := make([]byte, checksumLength)
+	if _, err := io.ReadFull(cr, checksum); err != nil {
+		return nil, decodeErr(err, ErrDecodeSeekableDeltaInvalidFormat)
+	}
+	if checksumLength == 0 {
+		checksum = nil
+	}
+
+	segments, err := readSeekableDeltaIndex(cr, int64(chunkSize), int64(originSize))
+	if err != nil {
+		return nil, err
+	}
+	// literal data starts right after index
+	for i := range segments {
+		if !segments[i].isCopy() {
+			segments[i].dataOffset += cr.n
+		}
+	}
+
+	return &SeekableDelta{
+		r:         r,
+		chunkSize: int(chunkSize),
+		segments:  segments,
+		size:      layoutSize(segments),
+		checksum:  checksum,
+	}, nil
+}
+
+// reads segments of index, offsets of literal data are relative to the end of index
+func readSeekableDeltaIndex(cr *countingReader, chunkSize, originSize int64) ([]segment, error) {
+	count, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return nil, decodeErr(err, ErrDecodeSeekableDeltaInvalidFormat)
+	}
+
+	segments := make([]segment, 0)
+	offset, dataOffset := int64(0), int64(0)
+	for i := uint64(0); i < count; i++ {
+		tag, err := cr.ReadByte()
+		if err != nil {
+			return nil, decodeErr(err, ErrDecodeSeekableDeltaInvalidFormat)
+		}
+		s := segment{
+			offset:     offset,
+			chunkIndex: -1,
+		}
+		switch tag {
+		case seekableDeltaSegmentCopy:
+			chunkIndex, err := binary.ReadUvarint(cr)
+			if err != nil {
+				return nil, decodeErr(err, ErrDecodeSeekableDeltaInvalidFormat)
+			}
+			if chunkIndex > uint64(originSize/chunkSize) {
+				return nil, ErrDecodeSeekableDeltaInvalidFormat
+			}
+			s.chunkIndex = int(chunkIndex)
+		case seekableDeltaSegmentLiteral:
+			s.dataOffset = dataOffset
+		default:
+			return nil, ErrDecodeSeekableDeltaInvalidFormat
+		}
+
+		length, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return nil, decodeErr(err, ErrDecodeSeekableDeltaInvalidFormat)
+		}
+		s.length = int64(length)
+		if length == 0 || length > 1<<62 || s.isCopy() && int64(s.chunkIndex)*chunkSize+s.length > originSize {
+			return nil, ErrDecodeSeekableDeltaInvalidFormat
+		}
+		if !s.isCopy() {
+			dataOffset += s.length
+		}
+		offset += s.length
+		if offset > 1<<62 {
+			return nil, ErrDecodeSeekableDeltaInvalidFormat
+		}
+		segments = append(segments, s)
+	}
+	return segments, nil
+}
+
+// Size returns size of updated data
+func (d *SeekableDelta) Size() int64 {
+	return d.size
+}
+
+// Checksum returns checksum of updated data
+func (d *SeekableDelta) Checksum() []byte {
+	return d.checksum
+}
+
+// NewReader returns reader of updated data, only literal data and original data needed by reads are read
+func (d *SeekableDelta) NewReader(original io.ReaderAt) *PatchedReader {
+	return &PatchedReader{
+		original:  original,
+		literals:  d.r,
+		chunkSize: int64(d.chunkSize),
+		segments:  d.segments,
+		size:      d.size,
+	}
+}
+
+// returns segments with copies of following chunks merged into one segment
+func mergeCopySegments(segments []segment, chunkSize int64) []segment {
+	merged := make([]segment, 0, len(segments))
+	for _, s := range segments {
+		if n := len(merged); n > 0 && s.isCopy() && merged[n-1].isCopy() {
+			last := &merged[n-1]
+			if int64(s.chunkIndex)*chunkSize == int64(last.chunkIndex)*chunkSize+last.length {
+				last.length += s.length
+				continue
+			}
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// countingReader counts bytes read from r
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
@@ -0,0 +1,144 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingReaderAt counts bytes read from r
+type countingReaderAt struct {
+	r    io.ReaderAt
+	read int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read += int64(n)
+	return n, err
+}
+
+func TestSeekableDelta(t *testing.T) {
+	original := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(original)
+	updated := append([]byte{}, original[:16*1024]...)
+	updated = append(updated, bytes.Repeat([]byte("X"), 16*1024)...)
+	updated = append(updated, original[32*1024:48*1024]...)
+	updated = append(updated, bytes.Repeat([]byte("Y"), 16*1024)...)
+
+	signature, err := SignatureFromReader(bytes.NewReader(original), 1024)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader(updated), signature)
+	assert.NoError(t, err)
+
+	encoded := &bytes.Buffer{}
+	assert.NoError(t, WriteSeekableDelta(encoded, signature, delta))
+	// copied chunks are merged, so index is tiny
+	assert.Less(t, encoded.Len(), 32*1024+128)
+
+	cases := map[string]struct {
+		givenOffset     int64
+		givenLength     int
+		expectedMaxRead int64
+	}{
+		"copied range": {
+			givenOffset:     1000,
+			givenLength:     10000,
+			expectedMaxRead: 0,
+		},
+		"literal range": {
+			givenOffset:     20 * 1024,
+			givenLength:     100,
+			expectedMaxRead: 100,
+		},
+		"across segments": {
+			givenOffset:     30 * 1024,
+			givenLength:     20 * 1024,
+			expectedMaxRead: 2*1024 + 2*1024,
+		},
+		"whole data": {
+			givenOffset:     0,
+			givenLength:     len(updated),
+			expectedMaxRead: 32 * 1024,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			deltaReader := &countingReaderAt{r: bytes.NewReader(encoded.Bytes())}
+			seekable, err := OpenSeekableDelta(deltaReader)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(updated)), seekable.Size())
+			assert.Equal(t, delta.Checksum, seekable.Checksum())
+
+			// index is read with buffered reads
+			deltaReader.read = 0
+			r := seekable.NewReader(bytes.NewReader(original))
+			actual := make([]byte, c.givenLength)
+			n, err := r.ReadAt(actual, c.givenOffset)
+			assert.NoError(t, err)
+			assert.Equal(t, c.givenLength, n)
+			assert.Equal(t, updated[c.givenOffset:c.givenOffset+int64(c.givenLength)], actual)
+			assert.LessOrEqual(t, deltaReader.read, c.expectedMaxRead)
+		})
+	}
+}
+
+func TestSeekableDelta_Reader(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEE")
+	updated := []byte("AAAAXXBBBBCCCCDDDDEEZ")
+	signature, err := SignatureFromReader(bytes.NewReader(original), 4)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader(updated), signature)
+	assert.NoError(t, err)
+
+	encoded := &bytes.Buffer{}
+	assert.NoError(t, WriteSeekableDelta(encoded, signature, delta))
+	seekable, err := OpenSeekableDelta(bytes.NewReader(encoded.Bytes()))
+	assert.NoError(t, err)
+
+	actual, err := ioutil.ReadAll(seekable.NewReader(bytes.NewReader(original)))
+	assert.NoError(t, err)
+	assert.Equal(t, string(updated), string(actual))
+}
+
+func TestOpenSeekableDelta_Err(t *testing.T) {
+	cases := map[string]struct {
+		givenEncoded []byte
+		expected     error
+	}{
+		"err empty": {
+			givenEncoded: []byte{},
+			expected:     ErrDecodeSeekableDeltaInvalidFormat,
+		},
+		"err invalid magic": {
+			givenEncoded: []byte("RHDD\x01"),
+			expected:     ErrDecodeSeekableDeltaInvalidFormat,
+		},
+		"err unsupported version": {
+			givenEncoded: []byte("RHDX\x02"),
+			expected:     ErrDecodeSeekableDeltaUnsupportedVersion,
+		},
+		"err truncated index": {
+			givenEncoded: []byte("RHDX\x01\x04\x10\x00\x02\x01\x00"),
+			expected:     ErrDecodeSeekableDeltaInvalidFormat,
+		},
+		"err copy past origin": {
+			givenEncoded: []byte("RHDX\x01\x04\x10\x00\x01\x01\x03\x08"),
+			expected:     ErrDecodeSeekableDeltaInvalidFormat,
+		},
+		"err unknown segment": {
+			givenEncoded: []byte("RHDX\x01\x04\x10\x00\x01\x07\x01"),
+			expected:     ErrDecodeSeekableDeltaInvalidFormat,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := OpenSeekableDelta(bytes.NewReader(c.givenEncoded))
+			assert.Equal(t, c.expected, err)
+		})
+	}
+}
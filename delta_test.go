@@ -1,6 +1,8 @@
 package rolling_hash_diff
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -377,14 +379,18 @@ func TestDeltaCalculator_Delta(t *testing.T) {
 			m := &deltaCalculatorMock{}
 			c.mock(m)
 
-			calc := newDeltaCalculator(c.givenOrigin, m)
+			calc := newDeltaCalculator(NewSignatureIndex(c.givenOrigin), m)
 			for _, d := range c.givenData {
 				_, err := calc.Write(d)
 				assert.NoError(t, err)
 			}
 			actual, err := calc.Delta()
 			assert.NoError(t, err)
-			assert.Equal(t, c.expected, actual)
+
+			expected := c.expected
+			expectedChecksum := sha256.Sum256(bytes.Join(c.givenData, nil))
+			expected.Checksum = expectedChecksum[:]
+			assert.Equal(t, expected, actual)
 
 			m.AssertExpectations(t)
 		})
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -44,4 +45,12 @@ func main() {
 	}
 
 	fmt.Printf("%+v\n", delta)
+
+	// apply delta to original data
+	updatedData := &bytes.Buffer{}
+	if err := rolling.Apply(updatedData, bytes.NewReader(originalData), originalSignature, delta); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(bytes.Equal(data, updatedData.Bytes()))
 }
@@ -2,6 +2,14 @@ package rolling_hash_diff
 
 import "crypto/sha256"
 
-var (
-	defaultHashCalculator = sha256.New()
-)
+// returns new instance of hash calculator used by default, every calculator must own its instance
+// because hash calculators are not safe for concurrent use
+func newDefaultHashCalculator() HashCalculator {
+	return sha256.New()
+}
+
+// NewChecksumCalculator returns new instance of hash calculator used to calculate Delta.Checksum of whole updated data,
+// e.g. to verify data reconstructed without Apply
+func NewChecksumCalculator() HashCalculator {
+	return sha256.New()
+}
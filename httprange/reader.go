@@ -0,0 +1,290 @@
+// Package httprange implements io.ReaderAt over HTTP Range requests, so remote objects can be read
+// without downloading them first, e.g. to calculate signature with ParallelSignatureCalculator:
+//
+//	r, err := httprange.NewReaderAt(ctx, url, httprange.Config{})
+//	signature, err := rolling.NewParallelSignatureCalculator(chunkSize, 0).Signature(r, r.Size())
+//
+// Object is fetched in blocks, following blocks are fetched ahead concurrently.
+package httprange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/httpx"
+)
+
+const (
+	// DefaultBlockSize is size of block fetched by one request if block size is not configured
+	DefaultBlockSize = 1024 * 1024
+	// DefaultReadAhead is number of blocks fetched ahead if read ahead is not configured
+	DefaultReadAhead = 4
+	// DefaultConcurrency is number of concurrent requests if concurrency is not configured
+	DefaultConcurrency = 4
+)
+
+// Config configures ReaderAt, zero values mean defaults
+type Config struct {
+	// Client sends requests, http.DefaultClient is used if it's nil
+	Client *http.Client
+	// BlockSize is number of bytes fetched by one request
+	BlockSize int64
+	// ReadAhead is number of blocks following read block fetched ahead, negative value disables read ahead
+	ReadAhead int
+	// Concurrency limits number of concurrent requests
+	Concurrency int
+}
+
+var (
+	ErrRangeNotSupported = errors.New("server doesn't support range requests")
+	ErrInvalidResponse   = errors.New("invalid range response")
+)
+
+// StatusError is returned when server responds with unexpected status
+type StatusError = httpx.StatusError
+
+// ReaderAt reads remote object with HTTP Range requests, it's safe to use concurrently
+type ReaderAt struct {
+	ctx       context.Context
+	client    *http.Client
+	url       string
+	size      int64
+	blockSize int64
+	readAhead int
+	requests  chan struct{}
+
+	mu     sync.Mutex
+	blocks map[int64]*block
+	// indexes of cached blocks from the oldest, used for eviction
+	order     []int64
+	maxBlocks int
+}
+
+type block struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewReaderAt returns reader of object at url, size of object is fetched by the first request.
+// Context is used by all requests sent by reader.
+func NewReaderAt(ctx context.Context, url string, config Config) (*ReaderAt, error) {
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	blockSize := config.BlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	readAhead := config.ReadAhead
+	if readAhead == 0 {
+		readAhead = DefaultReadAhead
+	}
+	if readAhead < 0 {
+		readAhead = 0
+	}
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	r := &ReaderAt{
+		ctx:       ctx,
+		client:    client,
+		url:       url,
+		blockSize: blockSize,
+		readAhead: readAhead,
+		requests:  make(chan struct{}, concurrency),
+		blocks:    make(map[int64]*block),
+		maxBlocks: 2*(readAhead+1) + concurrency,
+	}
+	size, err := r.fetchSize()
+	if err != nil {
+		return nil, err
+	}
+	r.size = size
+	return r, nil
+}
+
+// Size returns size of remote object
+func (r *ReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("httprange: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		index := off / r.blockSize
+		b := r.block(index)
+		r.fetchAhead(index)
+
+		select {
+		case <-b.done:
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		}
+		if b.err != nil {
+			return n, b.err
+		}
+		copied := copy(p[n:], b.data[off-index*r.blockSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// returns block with given index, its fetching is started if it isn't cached
+func (r *ReaderAt) block(index int64) *block {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.blocks[index]; ok {
+		return b
+	}
+	b := &block{
+		done: make(chan struct{}),
+	}
+	r.blocks[index] = b
+	r.order = append(r.order, index)
+	if len(r.order) > r.maxBlocks {
+		// evicted block is still available for readers waiting for it
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	go r.fetchBlock(index, b)
+	return b
+}
+
+func (r *ReaderAt) fetchAhead(index int64) {
+	blocksCount := (r.size + r.blockSize - 1) / r.blockSize
+	for i := index + 1; i <= index+int64(r.readAhead) && i < blocksCount; i++ {
+		r.block(i)
+	}
+}
+
+func (r *ReaderAt) fetchBlock(index int64, b *block) {
+	defer close(b.done)
+
+	select {
+	case r.requests <- struct{}{}:
+	case <-r.ctx.Done():
+		b.err = r.ctx.Err()
+		r.forget(index, b)
+		return
+	}
+	defer func() { <-r.requests }()
+
+	start := index * r.blockSize
+	end := start + r.blockSize
+	if end > r.size {
+		end = r.size
+	}
+	b.data, b.err = r.fetchRange(start, end)
+	if b.err != nil {
+		// failed block isn't cached, so it's fetched again by the next read
+		r.forget(index, b)
+	}
+}
+
+func (r *ReaderAt) forget(index int64, b *block) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.blocks[index] != b {
+		return
+	}
+	delete(r.blocks, index)
+	for i := range r.order {
+		if r.order[i] == index {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// fetches bytes [start, end) of object
+func (r *ReaderAt) fetchRange(start, end int64) ([]byte, error) {
+	resp, err := r.get(fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return nil, ErrRangeNotSupported
+	default:
+		return nil, httpx.NewStatusError(resp)
+	}
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrInvalidResponse
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// fetches size of object with request of its first byte
+func (r *ReaderAt) fetchSize() (int64, error) {
+	resp, err := r.get("bytes=0-0")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		// unsatisfiable range of the first byte means empty object
+		return parseContentRangeSize(resp.Header.Get("Content-Range"))
+	case http.StatusOK:
+		if resp.ContentLength == 0 {
+			return 0, nil
+		}
+		return 0, ErrRangeNotSupported
+	default:
+		return 0, httpx.NewStatusError(resp)
+	}
+}
+
+func (r *ReaderAt) get(byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", byteRange)
+	return r.client.Do(req)
+}
+
+// returns complete length from Content-Range header, e.g. "bytes 0-0/1234" or "bytes */1234"
+func parseContentRangeSize(contentRange string) (int64, error) {
+	i := strings.LastIndexByte(contentRange, '/')
+	if !strings.HasPrefix(contentRange, "bytes ") || i < 0 {
+		return 0, ErrInvalidResponse
+	}
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil || size < 0 {
+		return 0, ErrInvalidResponse
+	}
+	return size, nil
+}
@@ -0,0 +1,134 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/stretchr/testify/assert"
+)
+
+func newServer(data []byte, requests *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+		http.ServeContent(w, r, "object", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func TestReaderAt_Signature(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	var requests int64
+	server := newServer(data, &requests)
+	defer server.Close()
+
+	r, err := NewReaderAt(context.Background(), server.URL, Config{BlockSize: 4096, Concurrency: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), r.Size())
+
+	actual, err := rolling.NewParallelSignatureCalculator(64, 4).Signature(r, r.Size())
+	assert.NoError(t, err)
+	expected, err := rolling.SignatureFromReader(bytes.NewReader(data), 64)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	// each block is fetched once, plus the size request
+	assert.Equal(t, int64(25+1), atomic.LoadInt64(&requests))
+}
+
+func TestReaderAt_ReadAt(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	var requests int64
+	server := newServer(data, &requests)
+	defer server.Close()
+
+	cases := map[string]struct {
+		givenOffset   int64
+		givenLength   int
+		expected      string
+		expectedError error
+	}{
+		"inside block": {
+			givenOffset: 1,
+			givenLength: 3,
+			expected:    "123",
+		},
+		"across blocks": {
+			givenOffset: 6,
+			givenLength: 20,
+			expected:    "6789abcdefghijklmnop",
+		},
+		"until end": {
+			givenOffset: 30,
+			givenLength: 6,
+			expected:    "uvwxyz",
+		},
+		"past end": {
+			givenOffset:   30,
+			givenLength:   10,
+			expected:      "uvwxyz",
+			expectedError: io.EOF,
+		},
+		"at end": {
+			givenOffset:   36,
+			givenLength:   1,
+			expected:      "",
+			expectedError: io.EOF,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewReaderAt(context.Background(), server.URL, Config{BlockSize: 8, ReadAhead: -1})
+			assert.NoError(t, err)
+
+			p := make([]byte, c.givenLength)
+			n, err := r.ReadAt(p, c.givenOffset)
+			assert.Equal(t, c.expectedError, err)
+			assert.Equal(t, c.expected, string(p[:n]))
+		})
+	}
+}
+
+func TestNewReaderAt(t *testing.T) {
+	cases := map[string]struct {
+		givenHandler  http.HandlerFunc
+		expectedSize  int64
+		expectedError error
+	}{
+		"empty object": {
+			givenHandler: func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "object", time.Time{}, bytes.NewReader(nil))
+			},
+			expectedSize: 0,
+		},
+		"err range not supported": {
+			givenHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("data"))
+			},
+			expectedError: ErrRangeNotSupported,
+		},
+		"err not found": {
+			givenHandler:  http.NotFound,
+			expectedError: &StatusError{StatusCode: http.StatusNotFound, Message: "404 page not found"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(c.givenHandler)
+			defer server.Close()
+
+			r, err := NewReaderAt(context.Background(), server.URL, Config{})
+			assert.Equal(t, c.expectedError, err)
+			if err == nil {
+				assert.Equal(t, c.expectedSize, r.Size())
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package httpsync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/httpx"
+)
+
+// Client uploads and downloads objects served by Handler transferring only deltas
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	chunkSize  int
+}
+
+// StatusError is returned when handler responds with unexpected status
+type StatusError = httpx.StatusError
+
+// NewClient returns client of handler mounted at baseURL, http.DefaultClient is used if httpClient is nil
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+		chunkSize:  rolling.DefaultChunkSize,
+	}
+}
+
+// SetChunkSize sets chunk size of signatures used for deltas
+func (c *Client) SetChunkSize(chunkSize int) {
+	c.chunkSize = chunkSize
+}
+
+// Signature returns signature of stored object version
+func (c *Client) Signature(ctx context.Context, name, version string) (rolling.Signature, error) {
+	query := url.Values{
+		"chunk_size": {strconv.Itoa(c.chunkSize)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(name, version, "signature", query), nil)
+	if err != nil {
+		return rolling.Signature{}, err
+	}
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return rolling.Signature{}, err
+	}
+	defer resp.Body.Close()
+
+	return rolling.ReadSignature(resp.Body)
+}
+
+// Upload stores data read from r as object version, only delta against base version is sent
+func (c *Client) Upload(ctx context.Context, name, base, version string, r io.Reader) error {
+	signature, err := c.Signature(ctx, name, base)
+	if err != nil {
+		return err
+	}
+	delta, err := rolling.DeltaFromReaderContext(ctx, r, signature)
+	if err != nil {
+		return err
+	}
+	body := &bytes.Buffer{}
+	if err := rolling.WriteDelta(body, delta); err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"base":       {base},
+		"chunk_size": {strconv.Itoa(c.chunkSize)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(name, version, "", query), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Download writes object version to out, only delta against basis is received.
+// Basis is read twice: to calculate signature and to apply delta.
+func (c *Client) Download(ctx context.Context, name, version string, basis io.ReadSeeker, out io.Writer) error {
+	if _, err := basis.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	signature, err := rolling.SignatureFromReaderContext(ctx, basis, c.chunkSize, rolling.WithSmallInput())
+	if err != nil {
+		return err
+	}
+	body := &bytes.Buffer{}
+	if err := rolling.WriteSignature(body, signature); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.objectURL(name, version, "delta", nil), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	delta, err := rolling.ReadDelta(resp.Body)
+	if err != nil {
+		return err
+	}
+	if _, err := basis.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return rolling.ApplyContext(ctx, out, basis, signature, delta)
+}
+
+func (c *Client) objectURL(name, version, resource string, query url.Values) string {
+	u := c.baseURL + "/" + url.PathEscape(name) + "/" + url.PathEscape(version)
+	if resource != "" {
+		u += "/" + resource
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// sends request and returns response if it has expected status, otherwise response is closed
+func (c *Client) do(req *http.Request, expectedStatus int) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expectedStatus {
+		defer resp.Body.Close()
+		return nil, httpx.NewStatusError(resp)
+	}
+	return resp, nil
+}
@@ -0,0 +1,240 @@
+// Package httpsync integrates delta based uploads and downloads with net/http.
+//
+// Handler serves objects kept in Store under paths relative to its mount point:
+//
+//	GET  /{name}/{version}                                 full object
+//	PUT  /{name}/{version}                                 upload of full object
+//	PUT  /{name}/{version}?base={base}&chunk_size={size}   upload of encoded delta against base version
+//	GET  /{name}/{version}/signature?chunk_size={size}     encoded signature of object
+//	POST /{name}/{version}/delta                           encoded delta of object against encoded signature in body
+//
+// Client implements the other side: it computes deltas locally, so only changed data is transferred.
+package httpsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+)
+
+const contentType = "application/octet-stream"
+
+// Handler serves objects of store with support for delta uploads and downloads
+type Handler struct {
+	store Store
+}
+
+func NewHandler(store Store) *Handler {
+	return &Handler{
+		store: store,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, version, resource, err := parsePath(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case resource == "" && r.Method == http.MethodGet:
+		h.serveObject(w, r, name, version)
+	case resource == "" && r.Method == http.MethodPut:
+		h.putObject(w, r, name, version)
+	case resource == "signature" && r.Method == http.MethodGet:
+		h.serveSignature(w, r, name, version)
+	case resource == "delta" && r.Method == http.MethodPost:
+		h.serveDelta(w, r, name, version)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) serveObject(w http.ResponseWriter, r *http.Request, name, version string) {
+	object, err := h.store.Open(name, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer object.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	io.Copy(w, object)
+}
+
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, name, version string) {
+	base := r.URL.Query().Get("base")
+	if base == "" {
+		if err := h.store.Put(name, version, r.Body); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	chunkSize, err := parseChunkSize(r.URL)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	delta, err := rolling.ReadDelta(r.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// delta without checksum could be applied to other content of base than the client diffed against
+	if len(delta.Checksum) == 0 {
+		writeError(w, ErrMissingChecksum)
+		return
+	}
+	signature, err := h.signature(r.Context(), name, base, chunkSize)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	object, err := h.store.Open(name, base)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer object.Close()
+
+	// updated object is streamed to store, failed apply breaks the stream so nothing is stored
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(rolling.ApplyContext(r.Context(), pw, object, signature, delta))
+	}()
+	err = h.store.Put(name, version, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) serveSignature(w http.ResponseWriter, r *http.Request, name, version string) {
+	chunkSize, err := parseChunkSize(r.URL)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	signature, err := h.signature(r.Context(), name, version, chunkSize)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	rolling.WriteSignature(w, signature)
+}
+
+func (h *Handler) serveDelta(w http.ResponseWriter, r *http.Request, name, version string) {
+	signature, err := rolling.ReadSignature(r.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// buffers of chunk size are allocated to calculate delta
+	if signature.ChunkSize <= 0 || signature.ChunkSize > rolling.MaxChunkSize {
+		writeError(w, errInvalidChunkSize)
+		return
+	}
+
+	object, err := h.store.Open(name, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer object.Close()
+
+	delta, err := rolling.DeltaFromReaderContext(r.Context(), object, signature)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// delta is encoded before writing, so errors can still be reported with status code
+	buf := &bytes.Buffer{}
+	if err := rolling.WriteDelta(buf, delta); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
+
+// returns signature of object version, too small objects have signature without chunks
+func (h *Handler) signature(ctx context.Context, name, version string, chunkSize int) (rolling.Signature, error) {
+	object, err := h.store.Open(name, version)
+	if err != nil {
+		return rolling.Signature{}, err
+	}
+	defer object.Close()
+
+	return rolling.SignatureFromReaderContext(ctx, object, chunkSize, rolling.WithSmallInput())
+}
+
+// splits path into object name, version and optional resource
+func parsePath(u *url.URL) (string, string, string, error) {
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	if len(segments) < 2 || len(segments) > 3 {
+		return "", "", "", ErrInvalidName
+	}
+	for i := range segments {
+		segment, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return "", "", "", ErrInvalidName
+		}
+		segments[i] = segment
+	}
+	if len(segments) == 2 {
+		return segments[0], segments[1], "", nil
+	}
+	return segments[0], segments[1], segments[2], nil
+}
+
+var errInvalidChunkSize = errors.New("invalid chunk size")
+
+func parseChunkSize(u *url.URL) (int, error) {
+	value := u.Query().Get("chunk_size")
+	if value == "" {
+		return rolling.DefaultChunkSize, nil
+	}
+	chunkSize, err := strconv.Atoi(value)
+	if err != nil || chunkSize <= 0 || chunkSize > rolling.MaxChunkSize {
+		return 0, errInvalidChunkSize
+	}
+	return chunkSize, nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case os.IsNotExist(err):
+		status = http.StatusNotFound
+	case err == ErrInvalidName,
+		err == ErrMissingChecksum,
+		err == errInvalidChunkSize,
+		err == rolling.ErrDecodeDeltaInvalidFormat,
+		err == rolling.ErrDecodeDeltaUnsupportedVersion,
+		err == rolling.ErrDecodeSignatureInvalidFormat,
+		err == rolling.ErrDecodeSignatureUnsupportedVersion,
+		err == rolling.ErrApplyInvalidDelta,
+		err == rolling.ErrApplyChecksumMismatch:
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
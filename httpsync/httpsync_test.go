@@ -0,0 +1,156 @@
+package httpsync
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_UploadDownload(t *testing.T) {
+	store := NewDirStore(t.TempDir())
+	server := httptest.NewServer(NewHandler(store))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	client := NewClient(server.URL, &http.Client{Transport: transport})
+	client.SetChunkSize(64)
+	ctx := context.Background()
+
+	v1 := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	v2 := append([]byte{}, v1...)
+	copy(v2[30000:], "changed")
+
+	// the first version is uploaded in full
+	assert.NoError(t, store.Put("artifact", "v1", bytes.NewReader(v1)))
+
+	transport.sent = 0
+	assert.NoError(t, client.Upload(ctx, "artifact", "v1", "v2", bytes.NewReader(v2)))
+	assert.Less(t, transport.sent, int64(len(v2)/10))
+
+	resp, err := http.Get(server.URL + "/artifact/v2")
+	assert.NoError(t, err)
+	actual, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, v2, actual)
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, client.Download(ctx, "artifact", "v2", bytes.NewReader(v1), out))
+	assert.Equal(t, v2, out.Bytes())
+
+	out.Reset()
+	assert.NoError(t, client.Download(ctx, "artifact", "v1", bytes.NewReader([]byte("tiny")), out))
+	assert.Equal(t, v1, out.Bytes())
+}
+
+func TestClient_Err(t *testing.T) {
+	store := NewDirStore(t.TempDir())
+	server := httptest.NewServer(NewHandler(store))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	ctx := context.Background()
+	assert.NoError(t, store.Put("artifact", "v1", bytes.NewReader(bytes.Repeat([]byte("x"), 10000))))
+
+	cases := map[string]struct {
+		run            func() error
+		expectedStatus int
+	}{
+		"err not existing base": {
+			run: func() error {
+				return client.Upload(ctx, "artifact", "v0", "v2", bytes.NewReader([]byte("data")))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		"err not existing version": {
+			run: func() error {
+				return client.Download(ctx, "artifact", "v5", bytes.NewReader([]byte("data")), &bytes.Buffer{})
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		"err invalid name": {
+			run: func() error {
+				_, err := client.Signature(ctx, "..", "v1")
+				return err
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"err invalid delta": {
+			run: func() error {
+				resp, err := http.DefaultClient.Do(mustRequest(t, http.MethodPut, server.URL+"/artifact/v2?base=v1", []byte("not a delta")))
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+				return &StatusError{StatusCode: resp.StatusCode}
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"err delta without checksum": {
+			run: func() error {
+				delta := &bytes.Buffer{}
+				if err := rolling.WriteDelta(delta, rolling.Delta{Operations: []rolling.DeltaOperation{}}); err != nil {
+					return err
+				}
+				resp, err := http.DefaultClient.Do(mustRequest(t, http.MethodPut, server.URL+"/artifact/v2?base=v1", delta.Bytes()))
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+				return &StatusError{StatusCode: resp.StatusCode}
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"err signature chunk size too large": {
+			run: func() error {
+				signature := &bytes.Buffer{}
+				if err := rolling.WriteSignature(signature, rolling.EmptySignature(1<<40)); err != nil {
+					return err
+				}
+				resp, err := http.DefaultClient.Do(mustRequest(t, http.MethodPost, server.URL+"/artifact/v1/delta", signature.Bytes()))
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+				return &StatusError{StatusCode: resp.StatusCode}
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := c.run()
+
+			if assert.IsType(t, &StatusError{}, err) {
+				assert.Equal(t, c.expectedStatus, err.(*StatusError).StatusCode)
+			}
+		})
+	}
+
+	_, err := store.Open("artifact", "v2")
+	assert.Error(t, err)
+}
+
+func mustRequest(t *testing.T, method, url string, body []byte) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	assert.NoError(t, err)
+	return req
+}
+
+// countingTransport counts bytes of sent request bodies
+type countingTransport struct {
+	sent int64
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.ContentLength > 0 {
+		c.sent += req.ContentLength
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
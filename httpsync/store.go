@@ -0,0 +1,77 @@
+package httpsync
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeps versions of named objects
+type Store interface {
+	// Open returns reader of object version, returned error satisfies os.IsNotExist if it doesn't exist
+	Open(name, version string) (io.ReadCloser, error)
+	// Put stores object version with all data read from r, nothing is stored if reading r fails
+	Put(name, version string, r io.Reader) error
+}
+
+var (
+	ErrInvalidName     = errors.New("invalid object name or version")
+	ErrMissingChecksum = errors.New("delta doesn't contain checksum")
+)
+
+// DirStore is Store keeping object versions as files dir/name/version
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) DirStore {
+	return DirStore{
+		dir: dir,
+	}
+}
+
+func (s DirStore) Open(name, version string) (io.ReadCloser, error) {
+	path, err := s.path(name, version)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s DirStore) Put(name, version string, r io.Reader) error {
+	path, err := s.path(name, version)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// data is written to temporary file renamed after success, so partially written versions are never visible
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+version+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s DirStore) path(name, version string) (string, error) {
+	for _, part := range []string{name, version} {
+		if part == "" || part == "." || part == ".." || strings.HasPrefix(part, ".") || strings.ContainsAny(part, `/\`) {
+			return "", ErrInvalidName
+		}
+	}
+	return filepath.Join(s.dir, name, version), nil
+}
@@ -0,0 +1,36 @@
+// Package httpx contains HTTP helpers shared by packages of the module.
+package httpx
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxMessageSize limits part of response body kept as error message
+const maxMessageSize = 1024
+
+// StatusError is returned when server responds with unexpected status
+type StatusError struct {
+	StatusCode int
+	// Message is the beginning of response body, it can be empty
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// NewStatusError returns error of response with unexpected status, the beginning of its body is read as message
+func NewStatusError(resp *http.Response) *StatusError {
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(message)),
+	}
+}
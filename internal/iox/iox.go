@@ -0,0 +1,16 @@
+// Package iox contains io helpers shared by packages of the module.
+package iox
+
+import "io"
+
+// ReadFullAt reads exactly len(p) bytes at given offset, io.ErrUnexpectedEOF is returned if r ends earlier
+func ReadFullAt(r io.ReaderAt, p []byte, offset int64) error {
+	n, err := r.ReadAt(p, offset)
+	if n < len(p) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
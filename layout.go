@@ -0,0 +1,101 @@
+package rolling_hash_diff
+
+import (
+	"errors"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+var (
+	ErrSignatureInvalidSize = errors.New("signature size doesn't match its chunks")
+)
+
+// segment is a continuous piece of updated data, it's either copy of origin chunk or literal data from delta
+type segment struct {
+	// offset of the segment in updated data
+	offset int64
+	length int64
+	// index of copied origin chunk or -1 for literal data, copy can span following chunks
+	chunkIndex int
+	data       []byte
+	// offset of literal data in external literals source, used if data isn't loaded
+	dataOffset int64
+}
+
+func (s segment) isCopy() bool {
+	return s.chunkIndex >= 0
+}
+
+// returns segments of updated data described by delta calculated against origin signature, ordered by offset
+func deltaLayout(originSignature Signature, delta Delta) ([]segment, error) {
+	if err := ValidateSignatureSize(originSignature); err != nil {
+		return nil, err
+	}
+
+	chunksCount := len(originSignature.ChunksHashes)
+	additions, deletions, err := groupDeltaOperations(delta, chunksCount)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segment, 0, chunksCount)
+	offset := int64(0)
+	for i := 0; i <= chunksCount; i++ {
+		for _, data := range additions[i] {
+			if len(data) == 0 {
+				continue
+			}
+			segments = append(segments, segment{
+				offset:     offset,
+				length:     int64(len(data)),
+				chunkIndex: -1,
+				data:       data,
+			})
+			offset += int64(len(data))
+		}
+		if i == chunksCount || deletions[i] {
+			continue
+		}
+
+		length := chunkLength(originSignature, i)
+		segments = append(segments, segment{
+			offset:     offset,
+			length:     length,
+			chunkIndex: i,
+		})
+		offset += length
+	}
+	return segments, nil
+}
+
+// returns size of updated data described by segments
+func layoutSize(segments []segment) int64 {
+	if len(segments) == 0 {
+		return 0
+	}
+	last := segments[len(segments)-1]
+	return last.offset + last.length
+}
+
+// returns length of origin chunk with given index
+func chunkLength(signature Signature, index int) int64 {
+	chunkSize := int64(signature.ChunkSize)
+	return mathx.MinInt64(chunkSize, signature.Size-int64(index)*chunkSize)
+}
+
+// ValidateSignatureSize checks if signature size can be divided into its chunks,
+// signatures received from untrusted peers should be checked before chunk lengths are derived from them
+func ValidateSignatureSize(signature Signature) error {
+	if signature.ChunkSize <= 0 {
+		return ErrCalculateSignatureInvalidChunkSize
+	}
+
+	chunksCount := int64(len(signature.ChunksHashes))
+	chunkSize := int64(signature.ChunkSize)
+	if signature.Size <= (chunksCount-1)*chunkSize || signature.Size > chunksCount*chunkSize {
+		if chunksCount > 0 || signature.Size != 0 {
+			return ErrSignatureInvalidSize
+		}
+	}
+	return nil
+}
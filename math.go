@@ -1,8 +0,0 @@
-package rolling_hash_diff
-
-func min(x, y int) int {
-	if x < y {
-		return x
-	}
-	return y
-}
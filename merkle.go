@@ -0,0 +1,210 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// MerkleTree is hash tree built over chunks hashes of signature. Two peers can find differing chunks
+// by exchanging only hashes of differing subtrees, see DiffMerkleTrees.
+//
+// Node at level L and index i covers chunks from i*2^L to (i+1)*2^L, leaves are at level 0.
+// Node without right child is equal to its left child, so nodes of trees with different number of leaves
+// covering the same chunks are comparable.
+type MerkleTree struct {
+	chunkSize int
+	// levels from leaves to root
+	levels [][][]byte
+}
+
+// MerklePeer provides nodes of Merkle tree, usually remote one, e.g. through network request
+type MerklePeer interface {
+	// MerkleHeight returns number of tree levels
+	MerkleHeight() (int, error)
+	// MerkleNodes returns nodes at given level and indexes, nil is returned for not existing node
+	MerkleNodes(level int, indexes []int) ([][]byte, error)
+}
+
+var (
+	ErrMerkleInvalidNodes  = errors.New("merkle peer returned invalid number of nodes")
+	ErrMerkleInvalidHeight = errors.New("merkle peer height doesn't match size of remote data")
+)
+
+const (
+	merkleLeafPrefix = 0
+	merkleNodePrefix = 1
+)
+
+// NewMerkleTree builds Merkle tree over chunks hashes of given signature
+func NewMerkleTree(signature Signature) MerkleTree {
+	return newMerkleTree(signature, newDefaultHashCalculator())
+}
+
+func newMerkleTree(signature Signature, hashCalc HashCalculator) MerkleTree {
+	if len(signature.ChunksHashes) == 0 {
+		return MerkleTree{
+			chunkSize: signature.ChunkSize,
+		}
+	}
+
+	leaves := make([][]byte, len(signature.ChunksHashes))
+	for i, hash := range signature.ChunksHashes {
+		leaves[i] = merkleHash(hashCalc, merkleLeafPrefix, hash)
+	}
+
+	levels := [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		parents := make([][]byte, (len(level)+1)/2)
+		for i := range parents {
+			if 2*i+1 == len(level) {
+				parents[i] = level[2*i]
+				continue
+			}
+			parents[i] = merkleHash(hashCalc, merkleNodePrefix, level[2*i], level[2*i+1])
+		}
+		levels = append(levels, parents)
+		level = parents
+	}
+	return MerkleTree{
+		chunkSize: signature.ChunkSize,
+		levels:    levels,
+	}
+}
+
+// Root returns root hash or nil for empty tree
+func (t MerkleTree) Root() []byte {
+	if len(t.levels) == 0 {
+		return nil
+	}
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Height returns number of tree levels
+func (t MerkleTree) Height() int {
+	return len(t.levels)
+}
+
+// LeavesCount returns number of leaves, equal to number of chunks of signature
+func (t MerkleTree) LeavesCount() int {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return len(t.levels[0])
+}
+
+// Node returns node at given level and index or nil if it doesn't exist,
+// node at level above the root and index 0 is equal to the root
+func (t MerkleTree) Node(level, index int) []byte {
+	if level < 0 || index < 0 || len(t.levels) == 0 {
+		return nil
+	}
+	if level >= len(t.levels) {
+		if index == 0 {
+			return t.Root()
+		}
+		return nil
+	}
+	if index >= len(t.levels[level]) {
+		return nil
+	}
+	return t.levels[level][index]
+}
+
+func (t MerkleTree) MerkleHeight() (int, error) {
+	return t.Height(), nil
+}
+
+func (t MerkleTree) MerkleNodes(level int, indexes []int) ([][]byte, error) {
+	nodes := make([][]byte, len(indexes))
+	for i, index := range indexes {
+		nodes[i] = t.Node(level, index)
+	}
+	return nodes, nil
+}
+
+// DiffMerkleTrees returns ranges of chunks which differ between local and remote tree,
+// chunks existing only in one of the trees are different as well.
+// Only children of differing nodes are requested from remote peer, level by level,
+// so number of exchanged hashes is proportional to number of changes times tree height.
+//
+// Remote tree has to be built over chunks of local chunk size and remoteSize is size of remote data,
+// e.g. taken from its signature. Remote height not matching it is rejected with ErrMerkleInvalidHeight
+// and nodes beyond chunks of the larger tree are never requested.
+func DiffMerkleTrees(local MerkleTree, remote MerklePeer, remoteSize int64) ([]ChunkRange, error) {
+	if local.chunkSize <= 0 {
+		return nil, ErrCalculateSignatureInvalidChunkSize
+	}
+	if remoteSize < 0 {
+		return nil, ErrMerkleInvalidHeight
+	}
+	remoteLeavesCount := chunksCount(remoteSize, local.chunkSize)
+	remoteHeight, err := remote.MerkleHeight()
+	if err != nil {
+		return nil, err
+	}
+	if remoteHeight != merkleHeight(remoteLeavesCount) {
+		return nil, ErrMerkleInvalidHeight
+	}
+
+	var ranges []ChunkRange
+	height := mathx.Max(local.Height(), remoteHeight)
+	leavesCount := mathx.Max(local.LeavesCount(), remoteLeavesCount)
+	indexes := []int{0}
+	for level := height - 1; level >= 0 && len(indexes) > 0; level-- {
+		remoteNodes, err := remote.MerkleNodes(level, indexes)
+		if err != nil {
+			return nil, err
+		}
+		if len(remoteNodes) != len(indexes) {
+			return nil, ErrMerkleInvalidNodes
+		}
+
+		var differing []int
+		for i, index := range indexes {
+			if bytes.Equal(local.Node(level, index), remoteNodes[i]) {
+				continue
+			}
+			if level == 0 {
+				ranges = appendChunkRange(ranges, index)
+				continue
+			}
+			differing = append(differing, 2*index)
+			if 2*index+1 < merkleNodesCount(leavesCount, level-1) {
+				differing = append(differing, 2*index+1)
+			}
+		}
+		indexes = differing
+	}
+	return ranges, nil
+}
+
+// returns height of tree with given number of leaves
+func merkleHeight(leavesCount int) int {
+	if leavesCount == 0 {
+		return 0
+	}
+	height := 1
+	for count := leavesCount; count > 1; count = (count + 1) / 2 {
+		height++
+	}
+	return height
+}
+
+// returns number of nodes at given level of tree with given number of leaves
+func merkleNodesCount(leavesCount, level int) int {
+	if leavesCount == 0 {
+		return 0
+	}
+	return (leavesCount-1)>>uint(level) + 1
+}
+
+func merkleHash(hashCalc HashCalculator, prefix byte, parts ...[]byte) []byte {
+	hashCalc.Reset()
+	hashCalc.Write([]byte{prefix})
+	for _, p := range parts {
+		hashCalc.Write(p)
+	}
+	return hashCalc.Sum(nil)
+}
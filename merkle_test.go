@@ -0,0 +1,136 @@
+package rolling_hash_diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffMerkleTrees(t *testing.T) {
+	cases := map[string]struct {
+		givenLocal  [][]byte
+		givenRemote [][]byte
+		expected    []ChunkRange
+	}{
+		"identical": {
+			givenLocal:  [][]byte{{1}, {2}, {3}, {4}, {5}},
+			givenRemote: [][]byte{{1}, {2}, {3}, {4}, {5}},
+		},
+		"changed chunks": {
+			givenLocal:  [][]byte{{1}, {2}, {3}, {4}, {5}, {6}, {7}},
+			givenRemote: [][]byte{{1}, {9}, {9}, {4}, {5}, {6}, {9}},
+			expected:    []ChunkRange{{Start: 1, End: 3}, {Start: 6, End: 7}},
+		},
+		"remote has more chunks": {
+			givenLocal:  [][]byte{{1}, {2}, {3}, {4}},
+			givenRemote: [][]byte{{1}, {2}, {3}, {4}, {5}, {6}},
+			expected:    []ChunkRange{{Start: 4, End: 6}},
+		},
+		"local has more chunks": {
+			givenLocal:  [][]byte{{1}, {2}, {3}, {4}, {5}},
+			givenRemote: [][]byte{{1}, {9}, {3}},
+			expected:    []ChunkRange{{Start: 1, End: 2}, {Start: 3, End: 5}},
+		},
+		"remote empty": {
+			givenLocal:  [][]byte{{1}, {2}},
+			givenRemote: [][]byte{},
+			expected:    []ChunkRange{{Start: 0, End: 2}},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			local := NewMerkleTree(Signature{ChunkSize: 2, ChunksHashes: c.givenLocal})
+			remote := NewMerkleTree(Signature{ChunkSize: 2, ChunksHashes: c.givenRemote})
+
+			actual, err := DiffMerkleTrees(local, remote, int64(len(c.givenRemote))*2)
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, actual)
+			assert.Equal(t, c.expected == nil, string(local.Root()) == string(remote.Root()))
+		})
+	}
+}
+
+func TestDiffMerkleTrees_ExchangesOnlyDifferingSubtrees(t *testing.T) {
+	local := make([][]byte, 1024)
+	remote := make([][]byte, 1024)
+	for i := range local {
+		local[i] = []byte{byte(i), byte(i >> 8)}
+		remote[i] = local[i]
+	}
+	remote[500] = []byte{0}
+
+	peer := &countingMerklePeer{tree: NewMerkleTree(Signature{ChunkSize: 2, ChunksHashes: remote})}
+	actual, err := DiffMerkleTrees(NewMerkleTree(Signature{ChunkSize: 2, ChunksHashes: local}), peer, int64(len(remote))*2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ChunkRange{{Start: 500, End: 501}}, actual)
+	// root and two children on every of 10 levels below it
+	assert.Equal(t, 21, peer.nodesCount)
+}
+
+func TestDiffMerkleTrees_Err(t *testing.T) {
+	hashes := [][]byte{{1}, {2}, {3}, {4}, {5}}
+
+	cases := map[string]struct {
+		givenLocalChunkSize int
+		givenRemoteHeight   int
+		givenRemoteSize     int64
+		expected            error
+	}{
+		"err remote height above size": {
+			givenLocalChunkSize: 2,
+			givenRemoteHeight:   40,
+			givenRemoteSize:     10,
+			expected:            ErrMerkleInvalidHeight,
+		},
+		"err remote height below size": {
+			givenLocalChunkSize: 2,
+			givenRemoteHeight:   4,
+			givenRemoteSize:     1000,
+			expected:            ErrMerkleInvalidHeight,
+		},
+		"err negative remote size": {
+			givenLocalChunkSize: 2,
+			givenRemoteHeight:   4,
+			givenRemoteSize:     -1,
+			expected:            ErrMerkleInvalidHeight,
+		},
+		"err invalid chunk size": {
+			givenLocalChunkSize: 0,
+			givenRemoteHeight:   4,
+			givenRemoteSize:     10,
+			expected:            ErrCalculateSignatureInvalidChunkSize,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			local := NewMerkleTree(Signature{ChunkSize: c.givenLocalChunkSize, ChunksHashes: hashes})
+			peer := &countingMerklePeer{tree: local, height: c.givenRemoteHeight}
+
+			_, err := DiffMerkleTrees(local, peer, c.givenRemoteSize)
+
+			assert.Equal(t, c.expected, err)
+			assert.Equal(t, 0, peer.nodesCount)
+		})
+	}
+}
+
+type countingMerklePeer struct {
+	tree       MerkleTree
+	nodesCount int
+	// height overrides height of tree if it isn't zero
+	height int
+}
+
+func (p *countingMerklePeer) MerkleHeight() (int, error) {
+	if p.height != 0 {
+		return p.height, nil
+	}
+	return p.tree.MerkleHeight()
+}
+
+func (p *countingMerklePeer) MerkleNodes(level int, indexes []int) ([][]byte, error) {
+	p.nodesCount += len(indexes)
+	return p.tree.MerkleNodes(level, indexes)
+}
@@ -0,0 +1,206 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrPatchMissingChecksum = errors.New("delta doesn't contain checksum")
+)
+
+// linkFile creates hard link, it's replaced in tests to simulate filesystems without hard links
+var linkFile = os.Link
+
+// PatchOption configures optional behaviour of PatchFile
+type PatchOption func(*patchOptions)
+
+type patchOptions struct {
+	backupPath string
+	applyOpts  []Option
+}
+
+// WithBackup makes PatchFile keep replaced file at backup path, existing backup is replaced. The file is hard linked
+// as backup or copied if linking fails, e.g. when backup path is on another filesystem.
+func WithBackup(path string) PatchOption {
+	return func(o *patchOptions) {
+		o.backupPath = path
+	}
+}
+
+// WithApplyOptions passes options, e.g. WithProgress, to apply of delta
+func WithApplyOptions(opts ...Option) PatchOption {
+	return func(o *patchOptions) {
+		o.applyOpts = append(o.applyOpts, opts...)
+	}
+}
+
+func newPatchOptions(opts []PatchOption) patchOptions {
+	var o patchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// PatchFile replaces file at path with updated data reconstructed from the file and delta calculated against
+// its signature. Updated data is written to temporary file in the same directory, synced and verified against
+// delta checksum before it's renamed over the file, so any failure leaves the file untouched. Updated file keeps
+// permissions including setuid, setgid and sticky bits, and owner if process is privileged to change it.
+func PatchFile(path string, delta Delta, originSignature Signature, opts ...PatchOption) error {
+	return PatchFileContext(context.Background(), path, delta, originSignature, opts...)
+}
+
+// PatchFileContext is PatchFile checking ctx between original chunks
+func PatchFileContext(ctx context.Context, path string, delta Delta, originSignature Signature, opts ...PatchOption) error {
+	o := newPatchOptions(opts)
+	if len(delta.Checksum) == 0 {
+		return ErrPatchMissingChecksum
+	}
+
+	original, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer original.Close()
+	info, err := original.Stat()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".patch-")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := ApplyContext(ctx, tmp, original, originSignature, delta, o.applyOpts...); err != nil {
+		return err
+	}
+	if err := copyFileMode(tmp, info); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	// data is read back after sync, so what is renamed is verified, not only what was written
+	if err := verifyFileChecksum(tmp, delta.Checksum); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if o.backupPath != "" {
+		if err := backupFile(original, info, o.backupPath); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	committed = true
+	return syncDir(dir)
+}
+
+func verifyFileChecksum(f *os.File, checksum []byte) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hashCalc := NewChecksumCalculator()
+	if _, err := io.Copy(hashCalc, f); err != nil {
+		return err
+	}
+	if !bytes.Equal(hashCalc.Sum(nil), checksum) {
+		return ErrApplyChecksumMismatch
+	}
+	return nil
+}
+
+// keeps original file at backup path, existing backup is replaced atomically
+func backupFile(original *os.File, info os.FileInfo, backupPath string) error {
+	// temporary file only reserves unique name in backup directory, so nothing else is removed
+	tmp, err := ioutil.TempFile(filepath.Dir(backupPath), "."+filepath.Base(backupPath)+".backup-")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(tmp.Name()); err != nil {
+		return err
+	}
+	if err := linkFile(original.Name(), tmp.Name()); err != nil {
+		if err := copyBackup(original, info, tmp.Name()); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), backupPath); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// copies original file to path, used if file can't be hard linked
+func copyBackup(original *os.File, info os.FileInfo, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := original.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, original); err != nil {
+		return err
+	}
+	if err := copyFileMode(f, info); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// sets permissions and owner of file from info, owner is changed before mode because chown clears setuid and
+// setgid bits, failure to change owner without privileges is ignored
+func copyFileMode(f *os.File, info os.FileInfo) error {
+	if err := chownLike(f, info); err != nil {
+		return err
+	}
+	return f.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky))
+}
+
+// syncs directory, so rename of its entry is durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
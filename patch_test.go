@@ -0,0 +1,176 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchFile(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEE")
+	updated := []byte("AAAAXXXXCCCCDDDDEEZZ")
+
+	signature, err := SignatureFromReader(bytes.NewReader(original), 4)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader(updated), signature)
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		givenDelta     Delta
+		givenOriginal  []byte
+		givenBackup    bool
+		givenMode      os.FileMode
+		givenLinkErr   error
+		givenFiles     []string
+		expected       []byte
+		expectedFiles  []string
+		expectedBackup []byte
+		expectedError  error
+	}{
+		"patched": {
+			givenDelta:    delta,
+			givenOriginal: original,
+			expected:      updated,
+			expectedFiles: []string{"file"},
+		},
+		"patched with backup": {
+			givenDelta:     delta,
+			givenOriginal:  original,
+			givenBackup:    true,
+			expected:       updated,
+			expectedFiles:  []string{"file", "file.bak"},
+			expectedBackup: original,
+		},
+		"patched with backup copied if link fails": {
+			givenDelta:     delta,
+			givenOriginal:  original,
+			givenBackup:    true,
+			givenLinkErr:   &os.LinkError{Op: "link", Err: syscall.EXDEV},
+			expected:       updated,
+			expectedFiles:  []string{"file", "file.bak"},
+			expectedBackup: original,
+		},
+		"patched with backup, unrelated files kept": {
+			givenDelta:     delta,
+			givenOriginal:  original,
+			givenBackup:    true,
+			givenFiles:     []string{"file.bak.tmp"},
+			expected:       updated,
+			expectedFiles:  []string{"file", "file.bak", "file.bak.tmp"},
+			expectedBackup: original,
+		},
+		"patched with special mode bits": {
+			givenDelta:    delta,
+			givenOriginal: original,
+			givenMode:     0750 | os.ModeSetuid | os.ModeSetgid,
+			expected:      updated,
+			expectedFiles: []string{"file"},
+		},
+		"patched with backup copied with special mode bits": {
+			givenDelta:     delta,
+			givenOriginal:  original,
+			givenBackup:    true,
+			givenMode:      0750 | os.ModeSetuid | os.ModeSetgid,
+			givenLinkErr:   &os.LinkError{Op: "link", Err: syscall.EXDEV},
+			expected:       updated,
+			expectedFiles:  []string{"file", "file.bak"},
+			expectedBackup: original,
+		},
+		"err checksum mismatch": {
+			givenDelta: Delta{
+				Operations: delta.Operations,
+				Checksum:   []byte("invalid"),
+			},
+			givenOriginal: original,
+			givenBackup:   true,
+			expected:      original,
+			expectedFiles: []string{"file", "file.bak"},
+			// backup from previous run isn't replaced
+			expectedBackup: []byte("previous backup"),
+			expectedError:  ErrApplyChecksumMismatch,
+		},
+		"err original modified": {
+			givenDelta:    delta,
+			givenOriginal: []byte("AAAABBBBCCCCDDXDEE"),
+			expected:      []byte("AAAABBBBCCCCDDXDEE"),
+			expectedFiles: []string{"file"},
+			expectedError: ErrApplyChecksumMismatch,
+		},
+		"err missing checksum": {
+			givenDelta: Delta{
+				Operations: delta.Operations,
+			},
+			givenOriginal: original,
+			expected:      original,
+			expectedFiles: []string{"file"},
+			expectedError: ErrPatchMissingChecksum,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "file")
+			mode := c.givenMode
+			if mode == 0 {
+				mode = 0640
+			}
+			assert.NoError(t, ioutil.WriteFile(path, c.givenOriginal, 0600))
+			assert.NoError(t, os.Chmod(path, mode))
+			for _, name := range c.givenFiles {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("unrelated"), 0600))
+			}
+			if c.givenLinkErr != nil {
+				linkFile = func(oldname, newname string) error {
+					return c.givenLinkErr
+				}
+				defer func() {
+					linkFile = os.Link
+				}()
+			}
+			var opts []PatchOption
+			if c.givenBackup {
+				assert.NoError(t, ioutil.WriteFile(path+".bak", []byte("previous backup"), 0600))
+				opts = append(opts, WithBackup(path+".bak"))
+			}
+
+			err := PatchFile(path, c.givenDelta, signature, opts...)
+			assert.Equal(t, c.expectedError, err)
+
+			actual, err := ioutil.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, actual)
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			assert.Equal(t, mode, info.Mode())
+
+			files, err := ioutil.ReadDir(dir)
+			assert.NoError(t, err)
+			actualFiles := make([]string, 0, len(files))
+			for _, f := range files {
+				actualFiles = append(actualFiles, f.Name())
+			}
+			assert.Equal(t, c.expectedFiles, actualFiles)
+
+			if c.expectedBackup != nil {
+				backup, err := ioutil.ReadFile(path + ".bak")
+				assert.NoError(t, err)
+				assert.Equal(t, c.expectedBackup, backup)
+				if c.expectedError == nil {
+					info, err := os.Stat(path + ".bak")
+					assert.NoError(t, err)
+					assert.Equal(t, mode, info.Mode())
+				}
+			}
+			for _, name := range c.givenFiles {
+				data, err := ioutil.ReadFile(filepath.Join(dir, name))
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("unrelated"), data)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package rolling_hash_diff
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// changes owner of file to owner from info, EPERM is ignored because only privileged process can give file away
+func chownLike(f *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	err := f.Chown(int(stat.Uid), int(stat.Gid))
+	if errors.Is(err, syscall.EPERM) {
+		return nil
+	}
+	return err
+}
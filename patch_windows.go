@@ -0,0 +1,8 @@
+package rolling_hash_diff
+
+import "os"
+
+// files on windows don't have unix owner
+func chownLike(f *os.File, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package rolling_hash_diff
+
+import (
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/iox"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+var (
+	errPatchedReaderInvalidWhence = errors.New("invalid whence")
+	errPatchedReaderNegative      = errors.New("negative position")
+)
+
+// PatchedReader presents updated data described by original data and delta without reconstructing it,
+// reads are mapped through delta onto original data and literal data of delta
+type PatchedReader struct {
+	original io.ReaderAt
+	// source of literal data not loaded into segments
+	literals  io.ReaderAt
+	chunkSize int64
+	segments  []segment
+	size      int64
+	// position of Read and Seek
+	offset int64
+}
+
+// NewPatchedReader returns reader of updated data reconstructed from original data and delta calculated
+// against origin signature. Delta checksum isn't verified, since data is never read whole.
+func NewPatchedReader(original io.ReaderAt, originSignature Signature, delta Delta) (*PatchedReader, error) {
+	segments, err := deltaLayout(originSignature, delta)
+	if err != nil {
+		return nil, err
+	}
+	return &PatchedReader{
+		original:  original,
+		chunkSize: int64(originSignature.ChunkSize),
+		segments:  segments,
+		size:      layoutSize(segments),
+	}, nil
+}
+
+// Size returns size of updated data
+func (p *PatchedReader) Size() int64 {
+	return p.size
+}
+
+// ReadAt reads updated data at offset, it's safe to call it concurrently if original supports that
+func (p *PatchedReader) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errPatchedReaderNegative
+	}
+	if off >= p.size {
+		return 0, io.EOF
+	}
+
+	// the first segment containing offset
+	i := sort.Search(len(p.segments), func(i int) bool {
+		return p.segments[i].offset+p.segments[i].length > off
+	})
+	n := 0
+	for ; n < len(b) && i < len(p.segments); i++ {
+		s := p.segments[i]
+		inner := off + int64(n) - s.offset
+		length := int(mathx.MinInt64(int64(len(b)-n), s.length-inner))
+		switch {
+		case s.isCopy():
+			if err := iox.ReadFullAt(p.original, b[n:n+length], int64(s.chunkIndex)*p.chunkSize+inner); err != nil {
+				return n, err
+			}
+		case s.data == nil:
+			if err := iox.ReadFullAt(p.literals, b[n:n+length], s.dataOffset+inner); err != nil {
+				return n, err
+			}
+		default:
+			copy(b[n:n+length], s.data[inner:])
+		}
+		n += length
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (p *PatchedReader) Read(b []byte) (int, error) {
+	n, err := p.ReadAt(b, p.offset)
+	p.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (p *PatchedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += p.offset
+	case io.SeekEnd:
+		offset += p.size
+	default:
+		return 0, errPatchedReaderInvalidWhence
+	}
+	if offset < 0 {
+		return 0, errPatchedReaderNegative
+	}
+	p.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,111 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchedReader_ReadAt(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEE")
+	updated := []byte("XXAAAABBBBYYYYYYCCCCDDDDZ")
+
+	signature, err := SignatureFromReader(bytes.NewReader(original), 4)
+	assert.NoError(t, err)
+	delta := Delta{
+		Operations: []DeltaOperation{
+			{Type: OperationTypeAddition, ChunkIndex: 0, Data: []byte("XX")},
+			{Type: OperationTypeAddition, ChunkIndex: 2, Data: []byte("YYYYYY")},
+			{Type: OperationTypeDeletion, ChunkIndex: 4},
+			{Type: OperationTypeAddition, ChunkIndex: 5, Data: []byte("Z")},
+		},
+	}
+	r, err := NewPatchedReader(bytes.NewReader(original), signature, delta)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(updated)), r.Size())
+
+	cases := map[string]struct {
+		givenOffset   int64
+		givenLength   int
+		expectedError error
+	}{
+		"literal": {
+			givenOffset: 0,
+			givenLength: 2,
+		},
+		"inside copied chunk": {
+			givenOffset: 3,
+			givenLength: 2,
+		},
+		"across segments": {
+			givenOffset: 1,
+			givenLength: 20,
+		},
+		"whole data": {
+			givenOffset: 0,
+			givenLength: len(updated),
+		},
+		"past end": {
+			givenOffset:   20,
+			givenLength:   10,
+			expectedError: io.EOF,
+		},
+		"at end": {
+			givenOffset:   int64(len(updated)),
+			givenLength:   1,
+			expectedError: io.EOF,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := make([]byte, c.givenLength)
+			n, err := r.ReadAt(b, c.givenOffset)
+			assert.Equal(t, c.expectedError, err)
+
+			end := mathx.MinInt64(c.givenOffset+int64(c.givenLength), int64(len(updated)))
+			assert.Equal(t, string(updated[c.givenOffset:end]), string(b[:n]))
+		})
+	}
+}
+
+func TestPatchedReader_ReadSeek(t *testing.T) {
+	original := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	updated := append([]byte{}, original...)
+	copy(updated[500:], "changed")
+	updated = append(updated, "tail"...)
+
+	signature, err := SignatureFromReader(bytes.NewReader(original), 64)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader(updated), signature)
+	assert.NoError(t, err)
+
+	r, err := NewPatchedReader(bytes.NewReader(original), signature, delta)
+	assert.NoError(t, err)
+	actual, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, updated, actual)
+
+	offset, err := r.Seek(-10, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(updated)-10), offset)
+	actual, err = ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, updated[len(updated)-10:], actual)
+
+	_, err = r.Seek(495, io.SeekStart)
+	assert.NoError(t, err)
+	offset, err = r.Seek(5, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(500), offset)
+	b := make([]byte, 7)
+	_, err = io.ReadFull(r, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", string(b))
+
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+}
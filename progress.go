@@ -0,0 +1,157 @@
+package rolling_hash_diff
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress describes state of long running computation
+type Progress struct {
+	// BytesProcessed is number of bytes written to calculator or, for apply, written to output
+	BytesProcessed int64
+	ChunksHashed   int64
+	ChunksMatched  int64
+	// TotalBytes is expected number of bytes to process or -1 if it's unknown
+	TotalBytes int64
+}
+
+// ProgressFunc is called with current progress, it's called from the goroutine doing computation,
+// parallel calculators call it from their workers but never concurrently
+type ProgressFunc func(Progress)
+
+// Option configures optional behaviour of calculators and apply
+type Option func(*options)
+
+type options struct {
+	progressFunc     ProgressFunc
+	progressInterval time.Duration
+	totalBytes       int64
+	chunkHashHandler func(hash []byte) error
+	smallInput       bool
+}
+
+// WithProgress reports progress to fn at most once per interval and always once at the end of successful computation,
+// zero interval reports progress after every chunk
+func WithProgress(fn ProgressFunc, interval time.Duration) Option {
+	return func(o *options) {
+		o.progressFunc = fn
+		o.progressInterval = interval
+	}
+}
+
+// WithTotalBytes sets expected number of bytes to process reported in progress
+func WithTotalBytes(n int64) Option {
+	return func(o *options) {
+		o.totalBytes = n
+	}
+}
+
+// WithChunkHashHandler makes SignatureCalculator pass every chunk hash to fn as soon as it's calculated,
+// e.g. to SignatureEncoder.WriteChunkHash to stream signature, error returned by fn stops calculation
+func WithChunkHashHandler(fn func(hash []byte) error) Option {
+	return func(o *options) {
+		o.chunkHashHandler = fn
+	}
+}
+
+// WithSmallInput makes signature calculators return EmptySignature for data smaller than two chunks
+// instead of ErrCalculateSignatureInsufficientData, e.g. to calculate delta of any data against it
+func WithSmallInput() Option {
+	return func(o *options) {
+		o.smallInput = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		totalBytes: -1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// progressReporter collects progress and calls progress func when interval elapsed
+type progressReporter struct {
+	fn         ProgressFunc
+	interval   time.Duration
+	lastReport time.Time
+	progress   Progress
+}
+
+func newProgressReporter(o options) progressReporter {
+	return progressReporter{
+		fn:       o.progressFunc,
+		interval: o.progressInterval,
+		progress: Progress{
+			TotalBytes: o.totalBytes,
+		},
+	}
+}
+
+func (p *progressReporter) addBytes(n int) {
+	p.progress.BytesProcessed += int64(n)
+}
+
+func (p *progressReporter) addChunkHashed() {
+	p.progress.ChunksHashed++
+}
+
+func (p *progressReporter) addChunkMatched() {
+	p.progress.ChunksMatched++
+}
+
+// reports progress if interval elapsed since last report
+func (p *progressReporter) report() {
+	if p.fn == nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(p.lastReport) < p.interval {
+		return
+	}
+	p.lastReport = now
+	p.fn(p.progress)
+}
+
+// reports final progress
+func (p *progressReporter) finish() {
+	if p.fn == nil {
+		return
+	}
+	p.fn(p.progress)
+}
+
+// sharedProgressReporter is progressReporter safe to use by workers of parallel calculators
+type sharedProgressReporter struct {
+	mu       sync.Mutex
+	reporter progressReporter
+}
+
+func newSharedProgressReporter(o options) *sharedProgressReporter {
+	return &sharedProgressReporter{
+		reporter: newProgressReporter(o),
+	}
+}
+
+// adds chunk of given size hashed by worker and reports progress if interval elapsed
+func (p *sharedProgressReporter) addChunkHashed(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reporter.addBytes(size)
+	p.reporter.addChunkHashed()
+	p.reporter.report()
+}
+
+func (p *sharedProgressReporter) addChunkMatched() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reporter.addChunkMatched()
+}
+
+func (p *sharedProgressReporter) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reporter.finish()
+}
@@ -0,0 +1,138 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithProgress(t *testing.T) {
+	original := []byte("AAAABBBBCC")
+	updated := []byte("AAAAXXXXCC")
+
+	signature, err := SignatureFromReader(bytes.NewReader(original), 4)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader(updated), signature)
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		givenInterval time.Duration
+		run           func(opts ...Option) error
+		expected      []Progress
+	}{
+		"signature, every chunk": {
+			run: func(opts ...Option) error {
+				_, err := SignatureFromReader(bytes.NewReader(original), 4, opts...)
+				return err
+			},
+			expected: []Progress{
+				{BytesProcessed: 4, ChunksHashed: 1, TotalBytes: 10},
+				{BytesProcessed: 8, ChunksHashed: 2, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, TotalBytes: 10},
+			},
+		},
+		"delta, every chunk": {
+			run: func(opts ...Option) error {
+				_, err := DeltaFromReader(bytes.NewReader(updated), signature, opts...)
+				return err
+			},
+			expected: []Progress{
+				{BytesProcessed: 4, ChunksHashed: 1, ChunksMatched: 1, TotalBytes: 10},
+				{BytesProcessed: 8, ChunksHashed: 2, ChunksMatched: 1, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, ChunksMatched: 2, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, ChunksMatched: 2, TotalBytes: 10},
+			},
+		},
+		"apply, every chunk": {
+			run: func(opts ...Option) error {
+				return Apply(ioutil.Discard, bytes.NewReader(original), signature, delta, opts...)
+			},
+			expected: []Progress{
+				{BytesProcessed: 4, ChunksMatched: 1, TotalBytes: 10},
+				{BytesProcessed: 8, ChunksMatched: 1, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksMatched: 2, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksMatched: 2, TotalBytes: 10},
+			},
+		},
+		"parallel signature, every chunk": {
+			run: func(opts ...Option) error {
+				_, err := NewParallelSignatureCalculator(4, 1, opts...).Signature(bytes.NewReader(original), int64(len(original)))
+				return err
+			},
+			expected: []Progress{
+				{BytesProcessed: 4, ChunksHashed: 1, TotalBytes: 10},
+				{BytesProcessed: 8, ChunksHashed: 2, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, TotalBytes: 10},
+			},
+		},
+		"parallel delta, matched chunks reported at the end": {
+			run: func(opts ...Option) error {
+				_, err := NewParallelDeltaCalculator(signature, 1, opts...).Delta(bytes.NewReader(updated), int64(len(updated)))
+				return err
+			},
+			expected: []Progress{
+				{BytesProcessed: 4, ChunksHashed: 1, TotalBytes: 10},
+				{BytesProcessed: 8, ChunksHashed: 2, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, ChunksMatched: 2, TotalBytes: 10},
+			},
+		},
+		"delta, long interval reports first and final progress": {
+			givenInterval: time.Hour,
+			run: func(opts ...Option) error {
+				_, err := DeltaFromReader(bytes.NewReader(updated), signature, opts...)
+				return err
+			},
+			expected: []Progress{
+				{BytesProcessed: 4, ChunksHashed: 1, ChunksMatched: 1, TotalBytes: 10},
+				{BytesProcessed: 10, ChunksHashed: 3, ChunksMatched: 2, TotalBytes: 10},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var actual []Progress
+			progressFunc := func(p Progress) {
+				actual = append(actual, p)
+			}
+
+			err := c.run(WithProgress(progressFunc, c.givenInterval), WithTotalBytes(10))
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestWithProgress_UnknownTotal(t *testing.T) {
+	var actual Progress
+	_, err := SignatureFromReader(bytes.NewReader([]byte("AAAABBBB")), 4, WithProgress(func(p Progress) {
+		actual = p
+	}, 0))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Progress{BytesProcessed: 8, ChunksHashed: 2, TotalBytes: -1}, actual)
+}
+
+func TestWithProgress_ApplyErr(t *testing.T) {
+	original := []byte("AAAABBBBCC")
+	signature, err := SignatureFromReader(bytes.NewReader(original), 4)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader([]byte("AAAAXXXXCC")), signature)
+	assert.NoError(t, err)
+	delta.Checksum = make([]byte, len(delta.Checksum))
+
+	var actual []Progress
+	err = Apply(ioutil.Discard, bytes.NewReader(original), signature, delta, WithProgress(func(p Progress) {
+		actual = append(actual, p)
+	}, time.Hour))
+
+	// final progress isn't reported when apply fails
+	assert.Equal(t, ErrApplyChecksumMismatch, err)
+	assert.Equal(t, []Progress{{BytesProcessed: 4, ChunksMatched: 1, TotalBytes: -1}}, actual)
+}
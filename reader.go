@@ -0,0 +1,72 @@
+package rolling_hash_diff
+
+import (
+	"context"
+	"io"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// minimal size of buffer used to read data from io.Reader, the real size is multiply of chunk size
+const minReadBufferSize = 32 * 1024
+
+// SignatureFromReader calculates signature of all data read from r
+func SignatureFromReader(r io.Reader, chunkSize int, opts ...Option) (Signature, error) {
+	return SignatureFromReaderContext(context.Background(), r, chunkSize, opts...)
+}
+
+// SignatureFromReaderContext calculates signature of all data read from r,
+// ctx is checked between read chunks and its error is returned as soon as it's done
+func SignatureFromReaderContext(ctx context.Context, r io.Reader, chunkSize int, opts ...Option) (Signature, error) {
+	if chunkSize <= 0 {
+		return Signature{}, ErrCalculateSignatureInvalidChunkSize
+	}
+
+	calc := NewSignatureCalculator(chunkSize, opts...)
+	if err := copyContext(ctx, &calc, r, chunkSize); err != nil {
+		return Signature{}, err
+	}
+	return calc.Signature()
+}
+
+// DeltaFromReader calculates delta of all data read from r against origin signature
+func DeltaFromReader(r io.Reader, originSignature Signature, opts ...Option) (Delta, error) {
+	return DeltaFromReaderContext(context.Background(), r, originSignature, opts...)
+}
+
+// DeltaFromReaderContext calculates delta of all data read from r against origin signature,
+// ctx is checked between read chunks and its error is returned as soon as it's done
+func DeltaFromReaderContext(ctx context.Context, r io.Reader, originSignature Signature, opts ...Option) (Delta, error) {
+	if originSignature.ChunkSize <= 0 {
+		return Delta{}, ErrCalculateSignatureInvalidChunkSize
+	}
+
+	calc := NewDeltaCalculator(originSignature, opts...)
+	if err := copyContext(ctx, &calc, r, originSignature.ChunkSize); err != nil {
+		return Delta{}, err
+	}
+	return calc.Delta()
+}
+
+// copies all data from r to w in pieces being multiply of chunk size, checks ctx before every piece
+func copyContext(ctx context.Context, w io.Writer, r io.Reader, chunkSize int) error {
+	buf := make([]byte, chunkSize*mathx.Max(1, minReadBufferSize/chunkSize))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
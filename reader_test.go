@@ -0,0 +1,64 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatureFromReader(t *testing.T) {
+	data := make([]byte, 100*1024+3)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	for _, chunkSize := range []int{1, 7, 1024, 40 * 1024, 200 * 1024} {
+		calc := NewSignatureCalculator(chunkSize)
+		_, err := calc.Write(data)
+		assert.NoError(t, err)
+		expected, expectedErr := calc.Signature()
+
+		actual, err := SignatureFromReader(bytes.NewReader(data), chunkSize)
+
+		assert.Equal(t, expected, actual)
+		assert.Equal(t, expectedErr, err)
+	}
+}
+
+func TestDeltaFromReaderContext_Canceled(t *testing.T) {
+	signature, err := SignatureFromReader(bytes.NewReader([]byte("AAAABBBB")), 4)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// reader never ends, so only ctx can stop calculation
+	_, err = DeltaFromReaderContext(ctx, endlessReader{}, signature)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestSignatureFromReaderContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	actual, err := SignatureFromReaderContext(ctx, endlessReader{}, 4)
+
+	assert.Equal(t, Signature{}, actual)
+	assert.Equal(t, context.Canceled, err)
+}
+
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'A'
+	}
+	return len(p), nil
+}
+
+var _ io.Reader = endlessReader{}
@@ -0,0 +1,455 @@
+// Package s3 integrates signatures and deltas with S3 compatible object storage without AWS SDK.
+//
+// Signatures are calculated from objects read with ranged GETs, signatures and deltas can be stored
+// next to objects under keys with SignatureSuffix and DeltaSuffix. Deltas are applied by streaming
+// reconstructed object through multipart upload, so it's never kept whole in memory.
+// Buckets are addressed in path style: {endpoint}/{bucket}/{key}.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/httprange"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+const (
+	// SignatureSuffix is appended to object key to get key of its stored signature
+	SignatureSuffix = ".rhds"
+	// DeltaSuffix is appended to object key to get key of its stored delta
+	DeltaSuffix = ".rhdd"
+
+	// DefaultPartSize is size of multipart upload part if part size is not configured
+	DefaultPartSize = 8 * 1024 * 1024
+	// MinPartSize is the smallest part size, S3 requires parts other than the last one to be at least 5 MiB
+	MinPartSize = 5 * 1024 * 1024
+	// MaxPartsCount is the largest number of parts of multipart upload accepted by S3
+	MaxPartsCount = 10000
+	// DefaultRegion is used to sign requests if region is not configured
+	DefaultRegion = "us-east-1"
+)
+
+// Config configures Client, zero values mean defaults
+type Config struct {
+	// Endpoint is base URL of storage, e.g. https://s3.eu-west-1.amazonaws.com
+	Endpoint string
+	Region   string
+	// Requests aren't signed if AccessKeyID is empty
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Client sends requests, http.DefaultClient is used if it's nil
+	Client *http.Client
+	// PartSize is size of multipart upload part, it's raised to MinPartSize if it's smaller
+	// and grown for objects which wouldn't fit in MaxPartsCount parts
+	PartSize int64
+	// Workers is number of workers calculating signature, if it's less than 1 number of available CPUs is used
+	Workers int
+}
+
+var (
+	ErrTooManyParts = errors.New("s3: object doesn't fit in maximum number of multipart upload parts")
+)
+
+// Error is returned when storage responds with error
+type Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Client of S3 compatible storage
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	partSize   int64
+	workers    int
+}
+
+func NewClient(config Config) *Client {
+	httpClient := config.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	region := config.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	partSize := config.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	partSize = mathx.MaxInt64(partSize, MinPartSize)
+
+	signingClient := *httpClient
+	signingClient.Transport = &signingTransport{
+		base:            base,
+		region:          region,
+		accessKeyID:     config.AccessKeyID,
+		secretAccessKey: config.SecretAccessKey,
+		sessionToken:    config.SessionToken,
+		now:             time.Now,
+	}
+	return &Client{
+		endpoint:   strings.TrimRight(config.Endpoint, "/"),
+		httpClient: &signingClient,
+		partSize:   partSize,
+		workers:    config.Workers,
+	}
+}
+
+// Signature calculates signature of object, object is read with ranged GETs.
+// Object smaller than two chunks has rolling.EmptySignature.
+func (c *Client) Signature(ctx context.Context, bucket, key string, chunkSize int) (rolling.Signature, error) {
+	r, err := httprange.NewReaderAt(ctx, c.objectURL(bucket, key, nil), httprange.Config{
+		Client: c.httpClient,
+	})
+	if err != nil {
+		if statusErr, ok := err.(*httprange.StatusError); ok {
+			return rolling.Signature{}, &Error{StatusCode: statusErr.StatusCode}
+		}
+		return rolling.Signature{}, err
+	}
+	return rolling.NewParallelSignatureCalculator(chunkSize, c.workers, rolling.WithSmallInput()).Signature(r, r.Size())
+}
+
+// PutSignature stores encoded signature of object next to it
+func (c *Client) PutSignature(ctx context.Context, bucket, key string, signature rolling.Signature) error {
+	buf := &bytes.Buffer{}
+	if err := rolling.WriteSignature(buf, signature); err != nil {
+		return err
+	}
+	return c.PutObject(ctx, bucket, key+SignatureSuffix, buf.Bytes())
+}
+
+// GetSignature returns signature of object stored next to it
+func (c *Client) GetSignature(ctx context.Context, bucket, key string) (rolling.Signature, error) {
+	body, err := c.GetObject(ctx, bucket, key+SignatureSuffix)
+	if err != nil {
+		return rolling.Signature{}, err
+	}
+	defer body.Close()
+
+	return rolling.ReadSignature(body)
+}
+
+// PutDelta stores encoded delta of object next to it
+func (c *Client) PutDelta(ctx context.Context, bucket, key string, delta rolling.Delta) error {
+	buf := &bytes.Buffer{}
+	if err := rolling.WriteDelta(buf, delta); err != nil {
+		return err
+	}
+	return c.PutObject(ctx, bucket, key+DeltaSuffix, buf.Bytes())
+}
+
+// GetDelta returns delta of object stored next to it
+func (c *Client) GetDelta(ctx context.Context, bucket, key string) (rolling.Delta, error) {
+	body, err := c.GetObject(ctx, bucket, key+DeltaSuffix)
+	if err != nil {
+		return rolling.Delta{}, err
+	}
+	defer body.Close()
+
+	return rolling.ReadDelta(body)
+}
+
+// ApplyDelta stores under key object reconstructed from base object, its signature and delta.
+// Object is streamed through multipart upload, failed upload is aborted, so nothing is stored.
+func (c *Client) ApplyDelta(ctx context.Context, bucket, baseKey, key string, signature rolling.Signature, delta rolling.Delta) error {
+	base, err := c.GetObject(ctx, bucket, baseKey)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+
+	if err := rolling.ValidateSignatureSize(signature); err != nil {
+		return err
+	}
+	partSize, err := uploadPartSize(c.partSize, objectSize(signature, delta))
+	if err != nil {
+		return err
+	}
+	w := &uploadWriter{
+		ctx:    ctx,
+		client: c,
+		bucket: bucket,
+		key:    key,
+		buf:    make([]byte, 0, partSize),
+	}
+	if err := rolling.ApplyContext(ctx, w, base, signature, delta); err != nil {
+		w.abort()
+		return err
+	}
+	return w.Close()
+}
+
+// returns size of object reconstructed by applying delta, deletions of not existing chunks are skipped
+// because invalid delta is rejected by apply
+func objectSize(signature rolling.Signature, delta rolling.Delta) int64 {
+	chunkSize := int64(signature.ChunkSize)
+	size := signature.Size
+	for _, op := range delta.Operations {
+		switch {
+		case op.Type == rolling.OperationTypeAddition:
+			size += int64(len(op.Data))
+		case op.Type == rolling.OperationTypeDeletion && op.ChunkIndex >= 0 && op.ChunkIndex < len(signature.ChunksHashes):
+			size -= mathx.MinInt64(chunkSize, signature.Size-int64(op.ChunkIndex)*chunkSize)
+		}
+	}
+	return size
+}
+
+// returns part size grown so that object of given size fits in MaxPartsCount parts,
+// ErrTooManyParts is returned if such part couldn't be buffered in memory
+func uploadPartSize(partSize, size int64) (int64, error) {
+	minPartSize := (size + MaxPartsCount - 1) / MaxPartsCount
+	if minPartSize > int64(^uint(0)>>1) {
+		return 0, ErrTooManyParts
+	}
+	return mathx.MaxInt64(partSize, minPartSize), nil
+}
+
+// GetObject returns body of object, caller has to close it
+func (c *Client) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(bucket, key, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) PutObject(ctx context.Context, bucket, key string, data []byte) error {
+	_, err := c.send(ctx, http.MethodPut, c.objectURL(bucket, key, nil), data)
+	return err
+}
+
+// starts multipart upload and returns its id
+func (c *Client) createMultipartUpload(ctx context.Context, bucket, key string) (string, error) {
+	body, err := c.send(ctx, http.MethodPost, c.objectURL(bucket, key, url.Values{"uploads": {""}}), nil)
+	if err != nil {
+		return "", err
+	}
+	result := struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+// uploads part and returns its etag
+func (c *Client) uploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int, data []byte) (string, error) {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, c.objectURL(bucket, key, query), data)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *Client) completeMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	respBody, err := c.send(ctx, http.MethodPost, c.objectURL(bucket, key, url.Values{"uploadId": {uploadID}}), body)
+	if err != nil {
+		return err
+	}
+	// completion can fail after 200 status is sent, then error is in body
+	return parseError(http.StatusOK, respBody)
+}
+
+func (c *Client) abortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	_, err := c.send(ctx, http.MethodDelete, c.objectURL(bucket, key, url.Values{"uploadId": {uploadID}}), nil)
+	return err
+}
+
+// sends request and returns read response body
+func (c *Client) send(ctx context.Context, method, u string, data []byte) ([]byte, error) {
+	req, err := c.newRequest(ctx, method, u, data)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// returns request with payload hash used by signature
+func (c *Client) newRequest(ctx context.Context, method, u string, data []byte) (*http.Request, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	req.Header.Set(headerContentSHA256, hex.EncodeToString(hash[:]))
+	return req, nil
+}
+
+// sends request and returns response if it's successful, otherwise response is closed
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err := parseError(resp.StatusCode, body); err != nil {
+			return nil, err
+		}
+		return nil, &Error{StatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+func (c *Client) objectURL(bucket, key string, query url.Values) string {
+	u := c.endpoint + "/" + escape(bucket, true) + "/" + escape(key, false)
+	if len(query) > 0 {
+		// subresources without value, like uploads, are sent without equal sign
+		u += "?" + strings.Replace(query.Encode(), "uploads=", "uploads", 1)
+	}
+	return u
+}
+
+// returns error encoded in body, nil is returned if body doesn't contain error
+func parseError(statusCode int, body []byte) error {
+	result := struct {
+		XMLName xml.Name
+		Error
+	}{}
+	if err := xml.Unmarshal(body, &result); err != nil || result.XMLName.Local != "Error" {
+		return nil
+	}
+	result.Error.StatusCode = statusCode
+	return &result.Error
+}
+
+// uploadWriter uploads written data, it uses single PUT for data smaller than part size
+// and multipart upload otherwise
+type uploadWriter struct {
+	ctx    context.Context
+	client *Client
+	bucket string
+	key    string
+	buf    []byte
+
+	uploadID string
+	parts    []completedPart
+}
+
+func (w *uploadWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		copied := mathx.Min(len(p), cap(w.buf)-len(w.buf))
+		w.buf = append(w.buf, p[:copied]...)
+		p = p[copied:]
+		n += copied
+		if len(w.buf) < cap(w.buf) {
+			break
+		}
+		if err := w.flush(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// uploads buffered data as next part
+func (w *uploadWriter) flush() error {
+	if len(w.parts) == MaxPartsCount {
+		return ErrTooManyParts
+	}
+	if w.uploadID == "" {
+		uploadID, err := w.client.createMultipartUpload(w.ctx, w.bucket, w.key)
+		if err != nil {
+			return err
+		}
+		w.uploadID = uploadID
+	}
+	partNumber := len(w.parts) + 1
+	etag, err := w.client.uploadPart(w.ctx, w.bucket, w.key, w.uploadID, partNumber, w.buf)
+	if err != nil {
+		return err
+	}
+	w.parts = append(w.parts, completedPart{PartNumber: partNumber, ETag: etag})
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *uploadWriter) Close() error {
+	if w.uploadID == "" {
+		return w.client.PutObject(w.ctx, w.bucket, w.key, w.buf)
+	}
+	if len(w.buf) > 0 {
+		if err := w.flush(); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	if err := w.client.completeMultipartUpload(w.ctx, w.bucket, w.key, w.uploadID, w.parts); err != nil {
+		w.abort()
+		return err
+	}
+	return nil
+}
+
+// aborts started multipart upload, it's done even if context is cancelled
+func (w *uploadWriter) abort() {
+	if w.uploadID == "" {
+		return
+	}
+	w.client.abortMultipartUpload(context.Background(), w.bucket, w.key, w.uploadID)
+}
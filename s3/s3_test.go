@@ -0,0 +1,386 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "secret"
+)
+
+// fakeS3 is in-process storage implementing subset of S3 API used by Client, it verifies request signatures
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	// number of parts of completed multipart uploads
+	completedParts int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeFakeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	if !s.verifySignature(r, body) {
+		writeFakeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	path := r.URL.Path
+	if r.Method == http.MethodGet {
+		s.mu.Lock()
+		object, ok := s.objects[path]
+		s.mu.Unlock()
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		// object is served without lock, client uploads parts while it's still reading base object
+		http.ServeContent(w, r, path, time.Time{}, bytes.NewReader(object))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	_, uploads := query["uploads"]
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPut && uploadID == "":
+		s.objects[path] = body
+	case r.Method == http.MethodPost && uploads:
+		uploadID := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[uploadID] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case r.Method == http.MethodPut:
+		parts, ok := s.uploads[uploadID]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[partNumber] = body
+		hash := sha256.Sum256(body)
+		w.Header().Set("ETag", strconv.Quote(hex.EncodeToString(hash[:])))
+	case r.Method == http.MethodPost:
+		parts, ok := s.uploads[uploadID]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		complete := struct {
+			Parts []completedPart `xml:"Part"`
+		}{}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			writeFakeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		object := []byte{}
+		for _, part := range complete.Parts {
+			hash := sha256.Sum256(parts[part.PartNumber])
+			if part.ETag != strconv.Quote(hex.EncodeToString(hash[:])) {
+				// like S3, error is reported in body of successful response
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code></Error>")
+				return
+			}
+			object = append(object, parts[part.PartNumber]...)
+		}
+		s.objects[path] = object
+		s.completedParts += len(complete.Parts)
+		delete(s.uploads, uploadID)
+	case r.Method == http.MethodDelete:
+		delete(s.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// signs copy of request with test credentials and compares signatures
+func (s *fakeS3) verifySignature(r *http.Request, body []byte) bool {
+	payloadHash := r.Header.Get(headerContentSHA256)
+	hash := sha256.Sum256(body)
+	if payloadHash != hex.EncodeToString(hash[:]) && payloadHash != unsignedPayload {
+		return false
+	}
+	now, err := time.Parse("20060102T150405Z", r.Header.Get(headerDate))
+	if err != nil {
+		return false
+	}
+
+	signed := r.Clone(r.Context())
+	signed.URL.Host = r.Host
+	signed.Header.Del("Authorization")
+	transport := &signingTransport{
+		region:          DefaultRegion,
+		accessKeyID:     testAccessKeyID,
+		secretAccessKey: testSecretAccessKey,
+	}
+	transport.sign(signed, now)
+	return signed.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func (s *fakeS3) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeFakeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, strings.ToLower(code))
+}
+
+func newTestClient(endpoint string, partSize int64) *Client {
+	return NewClient(Config{
+		Endpoint:        endpoint,
+		AccessKeyID:     testAccessKeyID,
+		SecretAccessKey: testSecretAccessKey,
+		PartSize:        partSize,
+	})
+}
+
+func TestClient_ApplyDelta(t *testing.T) {
+	cases := map[string]struct {
+		givenSize              int
+		givenChunkSize         int
+		givenPartSize          int64
+		expectedCompletedParts int
+	}{
+		"multipart upload": {
+			givenSize:              12 * 1024 * 1024,
+			givenChunkSize:         64 * 1024,
+			givenPartSize:          MinPartSize,
+			expectedCompletedParts: 3,
+		},
+		"single upload": {
+			givenSize:      100000,
+			givenChunkSize: 256,
+			givenPartSize:  DefaultPartSize,
+		},
+		"part size raised to minimum": {
+			givenSize:      100000,
+			givenChunkSize: 256,
+			givenPartSize:  16 * 1024,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			v1 := make([]byte, c.givenSize)
+			rand.New(rand.NewSource(1)).Read(v1)
+			v2 := append([]byte{}, v1...)
+			copy(v2[50000:], "changed")
+
+			storage := newFakeS3()
+			server := httptest.NewServer(storage)
+			defer server.Close()
+
+			client := newTestClient(server.URL, c.givenPartSize)
+			ctx := context.Background()
+			assert.NoError(t, client.PutObject(ctx, "bucket", "dir/artifact v1", v1))
+
+			signature, err := client.Signature(ctx, "bucket", "dir/artifact v1", c.givenChunkSize)
+			assert.NoError(t, err)
+			expectedSignature, err := rolling.SignatureFromReader(bytes.NewReader(v1), c.givenChunkSize)
+			assert.NoError(t, err)
+			assert.Equal(t, expectedSignature, signature)
+			assert.NoError(t, client.PutSignature(ctx, "bucket", "dir/artifact v1", signature))
+
+			delta, err := rolling.DeltaFromReader(bytes.NewReader(v2), signature)
+			assert.NoError(t, err)
+			assert.NoError(t, client.PutDelta(ctx, "bucket", "dir/artifact v2", delta))
+
+			storedSignature, err := client.GetSignature(ctx, "bucket", "dir/artifact v1")
+			assert.NoError(t, err)
+			assert.Equal(t, signature, storedSignature)
+			storedDelta, err := client.GetDelta(ctx, "bucket", "dir/artifact v2")
+			assert.NoError(t, err)
+			assert.Equal(t, delta, storedDelta)
+
+			assert.NoError(t, client.ApplyDelta(ctx, "bucket", "dir/artifact v1", "dir/artifact v2", storedSignature, storedDelta))
+			body, err := client.GetObject(ctx, "bucket", "dir/artifact v2")
+			assert.NoError(t, err)
+			actual, err := ioutil.ReadAll(body)
+			body.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, v2, actual)
+
+			assert.Equal(t, c.expectedCompletedParts, storage.completedParts)
+			assert.Empty(t, storage.uploads)
+			assert.Equal(t, []string{
+				"/bucket/dir/artifact v1",
+				"/bucket/dir/artifact v1" + SignatureSuffix,
+				"/bucket/dir/artifact v2",
+				"/bucket/dir/artifact v2" + DeltaSuffix,
+			}, storage.keys())
+		})
+	}
+}
+
+func TestClient_Signature_SmallObject(t *testing.T) {
+	cases := map[string]struct {
+		givenObject []byte
+	}{
+		"empty object": {
+			givenObject: []byte{},
+		},
+		"object smaller than two chunks": {
+			givenObject: []byte("small"),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(newFakeS3())
+			defer server.Close()
+
+			client := newTestClient(server.URL, DefaultPartSize)
+			ctx := context.Background()
+			assert.NoError(t, client.PutObject(ctx, "bucket", "v1", c.givenObject))
+
+			signature, err := client.Signature(ctx, "bucket", "v1", 256)
+			assert.NoError(t, err)
+			assert.Equal(t, rolling.EmptySignature(256), signature)
+
+			delta, err := rolling.DeltaFromReader(bytes.NewReader([]byte("updated")), signature)
+			assert.NoError(t, err)
+			assert.NoError(t, client.ApplyDelta(ctx, "bucket", "v1", "v2", signature, delta))
+			body, err := client.GetObject(ctx, "bucket", "v2")
+			assert.NoError(t, err)
+			actual, err := ioutil.ReadAll(body)
+			body.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, "updated", string(actual))
+		})
+	}
+}
+
+func TestUploadPartSize(t *testing.T) {
+	cases := map[string]struct {
+		givenPartSize int64
+		givenSize     int64
+		expected      int64
+	}{
+		"object fits in parts": {
+			givenPartSize: MinPartSize,
+			givenSize:     MaxPartsCount * MinPartSize,
+			expected:      MinPartSize,
+		},
+		"part size grown for large object": {
+			givenPartSize: MinPartSize,
+			givenSize:     MaxPartsCount*MinPartSize + 1,
+			expected:      MinPartSize + 1,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := uploadPartSize(c.givenPartSize, c.givenSize)
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestUploadWriter_ErrTooManyParts(t *testing.T) {
+	w := &uploadWriter{
+		buf:      make([]byte, 0, 4),
+		uploadID: "upload",
+		parts:    make([]completedPart, MaxPartsCount),
+	}
+
+	_, err := w.Write([]byte("data"))
+
+	assert.Equal(t, ErrTooManyParts, err)
+}
+
+func TestClient_Err(t *testing.T) {
+	storage := newFakeS3()
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	ctx := context.Background()
+	client := newTestClient(server.URL, MinPartSize)
+	// reconstructed object is larger than part size, so multipart upload is started before apply fails
+	original := make([]byte, 6*1024*1024)
+	assert.NoError(t, client.PutObject(ctx, "bucket", "artifact", original))
+	signature, err := client.Signature(ctx, "bucket", "artifact", 64*1024)
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		run      func() error
+		expected error
+	}{
+		"err not existing object": {
+			run: func() error {
+				_, err := client.GetSignature(ctx, "bucket", "missing")
+				return err
+			},
+			expected: &Error{StatusCode: http.StatusNotFound, Code: "NoSuchKey", Message: "nosuchkey"},
+		},
+		"err invalid credentials": {
+			run: func() error {
+				client := NewClient(Config{
+					Endpoint:        server.URL,
+					AccessKeyID:     testAccessKeyID,
+					SecretAccessKey: "invalid",
+				})
+				return client.PutObject(ctx, "bucket", "artifact", []byte("data"))
+			},
+			expected: &Error{StatusCode: http.StatusForbidden, Code: "SignatureDoesNotMatch", Message: "signaturedoesnotmatch"},
+		},
+		"err apply mismatched delta aborts upload": {
+			run: func() error {
+				delta := rolling.Delta{
+					Operations: []rolling.DeltaOperation{
+						{Type: rolling.OperationTypeAddition, ChunkIndex: 20, Data: bytes.Repeat([]byte("x"), 2000)},
+					},
+					Checksum: []byte("invalid checksum"),
+				}
+				return client.ApplyDelta(ctx, "bucket", "artifact", "updated", signature, delta)
+			},
+			expected: rolling.ErrApplyChecksumMismatch,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, c.run())
+			assert.Empty(t, storage.uploads)
+			assert.Equal(t, []string{"/bucket/artifact"}, storage.keys())
+		})
+	}
+}
@@ -2,22 +2,45 @@ package rolling_hash_diff
 
 import (
 	"errors"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
 )
 
 // Signature is used to calculate delta for updated data
 type Signature struct {
 	ChunkSize    int
 	ChunksHashes [][]byte
-
-	//TODO: for backward compatibility must be stored version of used algorithm
+	// Size is length of data in bytes, only the last chunk can be shorter than chunk size
+	Size int64
+	// Algorithm used to calculate chunks hashes
+	Algorithm Algorithm
 }
 
+// Algorithm identifies hash function used to calculate signature, zero value is the default algorithm
+type Algorithm int
+
+const (
+	AlgorithmSHA256 Algorithm = iota
+)
+
+const (
+	// DefaultChunkSize is chunk size of signatures used by subpackages if it isn't configured
+	DefaultChunkSize = 4096
+	// MaxChunkSize limits chunk size of signatures accepted by subpackages from peers,
+	// buffers of chunk size are allocated for signatures and deltas
+	MaxChunkSize = 16 * 1024 * 1024
+)
+
 type SignatureCalculator struct {
 	chunkSize      int
 	hashCalculator HashCalculator
 
 	currentChunkSize int
 	chunksHashes     [][]byte
+	size             int64
+	progress         progressReporter
+	chunkHashHandler func(hash []byte) error
+	smallInput       bool
 }
 
 type HashCalculator interface {
@@ -30,14 +53,27 @@ var (
 	ErrCalculateSignatureInsufficientData = errors.New("insufficient data to calculate signature")
 )
 
-func NewSignatureCalculator(chunkSize int) SignatureCalculator {
-	return newSignatureCalculator(chunkSize, defaultHashCalculator)
+func NewSignatureCalculator(chunkSize int, opts ...Option) SignatureCalculator {
+	return newSignatureCalculator(chunkSize, newDefaultHashCalculator(), opts...)
 }
 
-func newSignatureCalculator(chunkSize int, hashCalc HashCalculator) SignatureCalculator {
+func newSignatureCalculator(chunkSize int, hashCalc HashCalculator, opts ...Option) SignatureCalculator {
+	o := newOptions(opts)
 	return SignatureCalculator{
-		chunkSize:      chunkSize,
-		hashCalculator: hashCalc,
+		chunkSize:        chunkSize,
+		hashCalculator:   hashCalc,
+		progress:         newProgressReporter(o),
+		chunkHashHandler: o.chunkHashHandler,
+		smallInput:       o.smallInput,
+	}
+}
+
+// EmptySignature returns signature matching no data, delta calculated against it contains whole updated data
+// and it's applied without reading original data
+func EmptySignature(chunkSize int) Signature {
+	return Signature{
+		ChunkSize:    chunkSize,
+		ChunksHashes: [][]byte{},
 	}
 }
 
@@ -45,7 +81,7 @@ func (s *SignatureCalculator) Write(data []byte) (int, error) {
 	fromIndex := 0
 	for {
 		maxChunkPartSize := s.chunkSize - s.currentChunkSize
-		toIndex := min(fromIndex+maxChunkPartSize, len(data))
+		toIndex := mathx.Min(fromIndex+maxChunkPartSize, len(data))
 
 		chunkPart := data[fromIndex:toIndex]
 		if _, err := s.hashCalculator.Write(chunkPart); err != nil {
@@ -54,9 +90,13 @@ func (s *SignatureCalculator) Write(data []byte) (int, error) {
 
 		chunkPartSize := toIndex - fromIndex
 		s.currentChunkSize += chunkPartSize
+		s.size += int64(chunkPartSize)
+		s.progress.addBytes(chunkPartSize)
 
 		if s.currentChunkSize == s.chunkSize {
-			s.calculateChunkHash()
+			if err := s.calculateChunkHash(); err != nil {
+				return 0, err
+			}
 		}
 
 		fromIndex += chunkPartSize
@@ -70,10 +110,16 @@ func (s *SignatureCalculator) Write(data []byte) (int, error) {
 // Returns calculated signature for written data, it's not safe to reuse SignatureCalculator after call this method
 func (s *SignatureCalculator) Signature() (Signature, error) {
 	if s.currentChunkSize > 0 {
-		s.calculateChunkHash()
+		if err := s.calculateChunkHash(); err != nil {
+			return Signature{}, err
+		}
 	}
+	s.progress.finish()
 
 	if len(s.chunksHashes) < 2 {
+		if s.smallInput {
+			return EmptySignature(s.chunkSize), nil
+		}
 		return Signature{}, ErrCalculateSignatureInsufficientData
 	}
 
@@ -82,13 +128,22 @@ func (s *SignatureCalculator) Signature() (Signature, error) {
 
 		//TODO: should be returned a deep copy of slice
 		ChunksHashes: s.chunksHashes,
+		Size:         s.size,
 	}, nil
 }
 
-func (s *SignatureCalculator) calculateChunkHash() {
+func (s *SignatureCalculator) calculateChunkHash() error {
 	hash := s.hashCalculator.Sum(nil)
 	s.chunksHashes = append(s.chunksHashes, hash)
 
 	s.hashCalculator.Reset()
 	s.currentChunkSize = 0
+
+	s.progress.addChunkHashed()
+	s.progress.report()
+
+	if s.chunkHashHandler != nil {
+		return s.chunkHashHandler(hash)
+	}
+	return nil
 }
@@ -0,0 +1,72 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// ChunkRange is range of chunks indexes from Start inclusive to End exclusive
+type ChunkRange struct {
+	Start int
+	End   int
+}
+
+// SignatureComparison describes which chunks differ between two signatures, chunks are compared by position
+type SignatureComparison struct {
+	Identical []ChunkRange
+	Changed   []ChunkRange
+	// Added are chunks present only in the second signature
+	Added []ChunkRange
+	// Removed are chunks present only in the first signature
+	Removed []ChunkRange
+}
+
+// InSync returns true if compared signatures describe the same data
+func (c SignatureComparison) InSync() bool {
+	return len(c.Changed) == 0 && len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+var (
+	ErrCompareSignaturesIncompatible = errors.New("signatures have different chunk size or algorithm")
+)
+
+// CompareSignatures returns ranges of chunks which are identical, changed, added or removed in b in comparison to a,
+// signatures must have the same chunk size and algorithm
+func CompareSignatures(a, b Signature) (SignatureComparison, error) {
+	if a.ChunkSize != b.ChunkSize || a.Algorithm != b.Algorithm {
+		return SignatureComparison{}, ErrCompareSignaturesIncompatible
+	}
+	for _, signature := range []Signature{a, b} {
+		if err := checkSignatureComplete(signature); err != nil {
+			return SignatureComparison{}, err
+		}
+	}
+
+	c := SignatureComparison{}
+	common := mathx.Min(len(a.ChunksHashes), len(b.ChunksHashes))
+	for i := 0; i < common; i++ {
+		if bytes.Equal(a.ChunksHashes[i], b.ChunksHashes[i]) {
+			c.Identical = appendChunkRange(c.Identical, i)
+		} else {
+			c.Changed = appendChunkRange(c.Changed, i)
+		}
+	}
+	if len(b.ChunksHashes) > common {
+		c.Added = append(c.Added, ChunkRange{Start: common, End: len(b.ChunksHashes)})
+	}
+	if len(a.ChunksHashes) > common {
+		c.Removed = append(c.Removed, ChunkRange{Start: common, End: len(a.ChunksHashes)})
+	}
+	return c, nil
+}
+
+// appends chunk index to ranges, extends the last range if index directly follows it
+func appendChunkRange(ranges []ChunkRange, index int) []ChunkRange {
+	if len(ranges) > 0 && ranges[len(ranges)-1].End == index {
+		ranges[len(ranges)-1].End++
+		return ranges
+	}
+	return append(ranges, ChunkRange{Start: index, End: index + 1})
+}
@@ -0,0 +1,109 @@
+package rolling_hash_diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareSignatures(t *testing.T) {
+	cases := map[string]struct {
+		givenA         Signature
+		givenB         Signature
+		expected       SignatureComparison
+		expectedInSync bool
+		expectedErr    error
+	}{
+		"identical": {
+			givenA: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}, {3}},
+			},
+			givenB: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}, {3}},
+			},
+			expected: SignatureComparison{
+				Identical: []ChunkRange{{Start: 0, End: 3}},
+			},
+			expectedInSync: true,
+		},
+		"changed inner chunks": {
+			givenA: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}, {3}, {4}, {5}, {6}},
+			},
+			givenB: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {9}, {9}, {4}, {9}, {6}},
+			},
+			expected: SignatureComparison{
+				Identical: []ChunkRange{{Start: 0, End: 1}, {Start: 3, End: 4}, {Start: 5, End: 6}},
+				Changed:   []ChunkRange{{Start: 1, End: 3}, {Start: 4, End: 5}},
+			},
+		},
+		"added chunks": {
+			givenA: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}},
+			},
+			givenB: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}, {3}, {4}},
+			},
+			expected: SignatureComparison{
+				Identical: []ChunkRange{{Start: 0, End: 2}},
+				Added:     []ChunkRange{{Start: 2, End: 4}},
+			},
+		},
+		"removed and changed chunks": {
+			givenA: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}, {3}},
+			},
+			givenB: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {9}},
+			},
+			expected: SignatureComparison{
+				Identical: []ChunkRange{{Start: 0, End: 1}},
+				Changed:   []ChunkRange{{Start: 1, End: 2}},
+				Removed:   []ChunkRange{{Start: 2, End: 3}},
+			},
+		},
+		"err different chunk size": {
+			givenA: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}},
+			},
+			givenB: Signature{
+				ChunkSize:    4,
+				ChunksHashes: [][]byte{{1}, {2}},
+			},
+			expectedErr: ErrCompareSignaturesIncompatible,
+		},
+		"err different algorithm": {
+			givenA: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}},
+			},
+			givenB: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}},
+				Algorithm:    Algorithm(42),
+			},
+			expectedErr: ErrCompareSignaturesIncompatible,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := CompareSignatures(c.givenA, c.givenB)
+
+			assert.Equal(t, c.expected, actual)
+			assert.Equal(t, c.expectedErr, err)
+			if c.expectedErr == nil {
+				assert.Equal(t, c.expectedInSync, actual.InSync())
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package rolling_hash_diff
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Encoded signature starts with header: magic, format version, algorithm and chunk size,
+// it's followed by chunk hash records and ends with record containing data size.
+// Records are written as soon as hashes are calculated, so signature can be sent while it's being calculated.
+var signatureMagic = []byte("RHDS")
+
+const (
+	signatureFormatVersion = 1
+
+	signatureRecordEnd       = 0
+	signatureRecordChunkHash = 1
+
+	// limit of decoded hash size protecting from allocation of huge buffers for corrupted input
+	maxHashSize = 1024
+
+	maxInt   = int(^uint(0) >> 1)
+	maxInt64 = int64(^uint64(0) >> 1)
+)
+
+var (
+	ErrDecodeSignatureInvalidFormat      = errors.New("invalid encoded signature format")
+	ErrDecodeSignatureUnsupportedVersion = errors.New("unsupported encoded signature version")
+	ErrEncodeSignatureClosed             = errors.New("signature encoder is closed")
+)
+
+// SignatureEncoder writes signature to w chunk by chunk
+type SignatureEncoder struct {
+	w             io.Writer
+	chunkSize     int
+	algorithm     Algorithm
+	headerWritten bool
+	closed        bool
+}
+
+func NewSignatureEncoder(w io.Writer, chunkSize int, algorithm Algorithm) *SignatureEncoder {
+	return &SignatureEncoder{
+		w:         w,
+		chunkSize: chunkSize,
+		algorithm: algorithm,
+	}
+}
+
+// WriteChunkHash writes hash of next chunk, it can be used as chunk hash handler of SignatureCalculator
+func (e *SignatureEncoder) WriteChunkHash(hash []byte) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	buf := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(hash))
+	buf[0] = signatureRecordChunkHash
+	n := binary.PutUvarint(buf[1:], uint64(len(hash)))
+	_, err := e.w.Write(append(buf[:1+n], hash...))
+	return err
+}
+
+// Close writes end of signature with size of data, encoder can't be used after that
+func (e *SignatureEncoder) Close(size int64) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	buf := make([]byte, 1+binary.MaxVarintLen64)
+	buf[0] = signatureRecordEnd
+	n := binary.PutUvarint(buf[1:], uint64(size))
+	if _, err := e.w.Write(buf[:1+n]); err != nil {
+		return err
+	}
+	e.closed = true
+	return nil
+}
+
+func (e *SignatureEncoder) writeHeader() error {
+	if e.closed {
+		return ErrEncodeSignatureClosed
+	}
+	if e.headerWritten {
+		return nil
+	}
+
+	buf := make([]byte, 0, len(signatureMagic)+1+2*binary.MaxVarintLen64)
+	buf = append(buf, signatureMagic...)
+	buf = append(buf, signatureFormatVersion)
+	buf = appendUvarint(buf, uint64(e.algorithm))
+	buf = appendUvarint(buf, uint64(e.chunkSize))
+	if _, err := e.w.Write(buf); err != nil {
+		return err
+	}
+	e.headerWritten = true
+	return nil
+}
+
+// WriteSignature writes whole encoded signature to w
+func WriteSignature(w io.Writer, signature Signature) error {
+	e := NewSignatureEncoder(w, signature.ChunkSize, signature.Algorithm)
+	for _, hash := range signature.ChunksHashes {
+		if err := e.WriteChunkHash(hash); err != nil {
+			return err
+		}
+	}
+	return e.Close(signature.Size)
+}
+
+// SignatureDecoder reads encoded signature chunk by chunk, it doesn't read from r more than encoded signature
+type SignatureDecoder struct {
+	r         byteReader
+	chunkSize int
+	algorithm Algorithm
+	size      int64
+	done      bool
+}
+
+// NewSignatureDecoder reads header of encoded signature
+func NewSignatureDecoder(r io.Reader) (*SignatureDecoder, error) {
+	br := byteReader{r: r}
+
+	magic := make([]byte, len(signatureMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+	}
+	if string(magic) != string(signatureMagic) {
+		return nil, ErrDecodeSignatureInvalidFormat
+	}
+	version, err := br.ReadByte()
+	if err != nil {
+		return nil, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+	}
+	if version != signatureFormatVersion {
+		return nil, ErrDecodeSignatureUnsupportedVersion
+	}
+	algorithm, err := readInt(br)
+	if err != nil {
+		return nil, err
+	}
+	// chunk size of decoded signature is used to allocate buffers of that size
+	chunkSize, err := readInt(br)
+	if err != nil {
+		return nil, err
+	}
+	if chunkSize > MaxChunkSize {
+		return nil, ErrDecodeSignatureInvalidFormat
+	}
+
+	return &SignatureDecoder{
+		r:         br,
+		chunkSize: chunkSize,
+		algorithm: Algorithm(algorithm),
+	}, nil
+}
+
+func (d *SignatureDecoder) ChunkSize() int {
+	return d.chunkSize
+}
+
+func (d *SignatureDecoder) Algorithm() Algorithm {
+	return d.algorithm
+}
+
+// Size returns size of data, it's known after Next returned io.EOF
+func (d *SignatureDecoder) Size() int64 {
+	return d.size
+}
+
+// Next returns hash of next chunk or io.EOF after the last one
+func (d *SignatureDecoder) Next() ([]byte, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return nil, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+	}
+	switch tag {
+	case signatureRecordEnd:
+		size, err := readInt64(d.r)
+		if err != nil {
+			return nil, err
+		}
+		d.size = size
+		d.done = true
+		return nil, io.EOF
+	case signatureRecordChunkHash:
+		hashSize, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return nil, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+		}
+		if hashSize > maxHashSize {
+			return nil, ErrDecodeSignatureInvalidFormat
+		}
+		hash := make([]byte, hashSize)
+		if _, err := io.ReadFull(d.r, hash); err != nil {
+			return nil, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+		}
+		return hash, nil
+	default:
+		return nil, ErrDecodeSignatureInvalidFormat
+	}
+}
+
+// ReadSignature reads whole encoded signature from r
+func ReadSignature(r io.Reader) (Signature, error) {
+	d, err := NewSignatureDecoder(r)
+	if err != nil {
+		return Signature{}, err
+	}
+
+	chunksHashes := make([][]byte, 0)
+	for {
+		hash, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Signature{}, err
+		}
+		chunksHashes = append(chunksHashes, hash)
+	}
+
+	return Signature{
+		ChunkSize:    d.ChunkSize(),
+		ChunksHashes: chunksHashes,
+		Size:         d.Size(),
+		Algorithm:    d.Algorithm(),
+	}, nil
+}
+
+// byteReader reads from r byte by byte without buffering, so nothing after encoded data is consumed
+type byteReader struct {
+	r io.Reader
+}
+
+func (b byteReader) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	if br, ok := b.r.(io.ByteReader); ok {
+		return br.ReadByte()
+	}
+	var buf [1]byte
+	if _, err := io.ReadFull(b.r, buf[:]); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+// reads uvarint which has to fit in int
+func readInt(br byteReader) (int, error) {
+	v, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+	}
+	if v > uint64(maxInt) {
+		return 0, ErrDecodeSignatureInvalidFormat
+	}
+	return int(v), nil
+}
+
+// reads uvarint which has to fit in int64
+func readInt64(br byteReader) (int64, error) {
+	v, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+	}
+	if v > uint64(maxInt64) {
+		return 0, ErrDecodeSignatureInvalidFormat
+	}
+	return int64(v), nil
+}
+
+// returns formatErr if err is caused by unexpected end of data
+func decodeErr(err, formatErr error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return formatErr
+	}
+	return err
+}
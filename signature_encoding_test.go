@@ -0,0 +1,116 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSignature_ReadSignature(t *testing.T) {
+	cases := map[string]struct {
+		given Signature
+	}{
+		"sha256 hashes": {
+			given: Signature{
+				ChunkSize:    4,
+				ChunksHashes: [][]byte{bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)},
+				Size:         7,
+			},
+		},
+		"different hash sizes, other algorithm": {
+			given: Signature{
+				ChunkSize:    1 << 20,
+				ChunksHashes: [][]byte{{1}, {2, 2}, {}},
+				Size:         3<<20 - 5,
+				Algorithm:    Algorithm(3),
+			},
+		},
+		"no chunks": {
+			given: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			assert.NoError(t, WriteSignature(buf, c.given))
+			buf.WriteString("rest")
+
+			actual, err := ReadSignature(buf)
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.given, actual)
+			assert.Equal(t, "rest", buf.String())
+		})
+	}
+}
+
+func TestReadSignature_Err(t *testing.T) {
+	encoded := &bytes.Buffer{}
+	assert.NoError(t, WriteSignature(encoded, Signature{
+		ChunkSize:    2,
+		ChunksHashes: [][]byte{{1}, {2}},
+		Size:         4,
+	}))
+
+	cases := map[string]struct {
+		given       []byte
+		expectedErr error
+	}{
+		"err empty": {
+			given:       []byte{},
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err invalid magic": {
+			given:       []byte("XXXX\x01\x00\x02\x00\x04"),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err unsupported version": {
+			given:       []byte("RHDS\x02\x00\x02\x00\x04"),
+			expectedErr: ErrDecodeSignatureUnsupportedVersion,
+		},
+		"err truncated": {
+			given:       encoded.Bytes()[:encoded.Len()-2],
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err unknown record": {
+			given:       []byte("RHDS\x01\x00\x02\x07"),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err algorithm overflowing int": {
+			given:       append(appendUvarint([]byte("RHDS\x01"), ^uint64(0)), "\x02\x00\x04"...),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err chunk size above limit": {
+			given:       append(appendUvarint([]byte("RHDS\x01\x00"), MaxChunkSize+1), "\x00\x04"...),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err chunk size overflowing int": {
+			given:       append(appendUvarint([]byte("RHDS\x01\x00"), ^uint64(0)), "\x00\x04"...),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err size overflowing int64": {
+			given:       appendUvarint([]byte("RHDS\x01\x00\x02\x00"), 1<<63),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := ReadSignature(bytes.NewReader(c.given))
+
+			assert.Equal(t, Signature{}, actual)
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
+
+func TestSignatureEncoder_Closed(t *testing.T) {
+	e := NewSignatureEncoder(ioutil.Discard, 2, AlgorithmSHA256)
+	assert.NoError(t, e.Close(0))
+
+	assert.Equal(t, ErrEncodeSignatureClosed, e.WriteChunkHash([]byte{1}))
+}
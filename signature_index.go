@@ -0,0 +1,66 @@
+package rolling_hash_diff
+
+import "sort"
+
+// SignatureIndex is prebuilt lookup structure of origin signature used to calculate delta.
+// It's immutable after creation, so one instance can be shared without copying or locking
+// by many DeltaCalculators and ParallelDeltaCalculators working concurrently.
+//
+// Index keeps own copy of chunks hashes in a map from hash to ascending chunk indexes,
+// it takes about (hash size + 55) bytes per unique chunk hash and 8 bytes per every repeated chunk,
+// e.g. ~85 MB for 1M unique chunks with SHA-256 hashes.
+// Source signature is not referenced by the index and can be released after creation.
+type SignatureIndex struct {
+	chunkSize   int
+	chunksCount int
+	chunks      map[string][]int
+}
+
+// NewSignatureIndex builds index of given signature
+func NewSignatureIndex(signature Signature) *SignatureIndex {
+	chunks := make(map[string][]int, len(signature.ChunksHashes))
+	for i, hash := range signature.ChunksHashes {
+		chunks[string(hash)] = append(chunks[string(hash)], i)
+	}
+	return &SignatureIndex{
+		chunkSize:   signature.ChunkSize,
+		chunksCount: len(signature.ChunksHashes),
+		chunks:      chunks,
+	}
+}
+
+// ChunkSize returns chunk size of indexed signature
+func (s *SignatureIndex) ChunkSize() int {
+	return s.chunkSize
+}
+
+// ChunksCount returns number of chunks of indexed signature
+func (s *SignatureIndex) ChunksCount() int {
+	return s.chunksCount
+}
+
+// returns indexes of origin chunks with given hash, returned slice must not be modified
+func (s *SignatureIndex) lookup(hash []byte) []int {
+	return s.chunks[string(hash)]
+}
+
+func (s *SignatureIndex) nextChunkIndex(hash []byte, after int) (int, error) {
+	return nextChunkIndex(s.lookup(hash), after), nil
+}
+
+func (s *SignatureIndex) hasChunk(index int) (bool, error) {
+	return index < s.chunksCount, nil
+}
+
+func (s *SignatureIndex) totalChunks() (int, error) {
+	return s.chunksCount, nil
+}
+
+// returns first index from ascending indexes greater than after or -1 if not found
+func nextChunkIndex(indexes []int, after int) int {
+	i := sort.SearchInts(indexes, after+1)
+	if i == len(indexes) {
+		return -1
+	}
+	return indexes[i]
+}
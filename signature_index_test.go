@@ -0,0 +1,52 @@
+package rolling_hash_diff
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatureIndex_SharedByManyDeltaCalculators(t *testing.T) {
+	signatureCalc := NewSignatureCalculator(4)
+	_, err := signatureCalc.Write([]byte("AAAABBBBCCCCDDDDAAAA"))
+	assert.NoError(t, err)
+	signature, err := signatureCalc.Signature()
+	assert.NoError(t, err)
+
+	index := NewSignatureIndex(signature)
+	assert.Equal(t, 4, index.ChunkSize())
+	assert.Equal(t, 5, index.ChunksCount())
+
+	givenData := [][]byte{
+		[]byte("AAAABBBBCCCCDDDDAAAA"),
+		[]byte("AAAAXXXXCCCCDDDD"),
+		[]byte("BBBBAAAA"),
+		[]byte("XXXXYYYYZZ"),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for _, data := range givenData {
+			wg.Add(1)
+			go func(data []byte) {
+				defer wg.Done()
+
+				expectedCalc := NewDeltaCalculator(signature)
+				_, err := expectedCalc.Write(data)
+				assert.NoError(t, err)
+				expected, err := expectedCalc.Delta()
+				assert.NoError(t, err)
+
+				calc := NewDeltaCalculatorFromIndex(index)
+				_, err = calc.Write(data)
+				assert.NoError(t, err)
+				actual, err := calc.Delta()
+				assert.NoError(t, err)
+
+				assert.Equal(t, expected, actual)
+			}(data)
+		}
+	}
+	wg.Wait()
+}
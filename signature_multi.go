@@ -0,0 +1,133 @@
+package rolling_hash_diff
+
+import (
+	"errors"
+	"io"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/iox"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// MultiSignature is signature with several chunk size levels used for coarse-then-fine matching. Only the coarse
+// signature is complete, every finer level holds hashes only of chunks covering mismatched chunks of the previous
+// level, so hashes of unchanged regions are never calculated nor sent. Exchange of signature goes as follows:
+//  1. original holder sends coarse signature with the largest chunk size,
+//  2. updated data is written to MultiDeltaCalculator and Mismatched returns ranges of finer chunks it needs,
+//  3. original holder calculates hashes of these ranges with SignatureLevelFromReaderAt and sends them back,
+//  4. the level is passed to MultiDeltaCalculator.Refine, steps 2-4 are repeated for every finer chunk size.
+//
+// Delta returned by MultiDeltaCalculator is applied against Finest signature.
+type MultiSignature struct {
+	Coarse Signature
+	// Levels are ordered from the largest chunk size and every chunk size is a divisor of the previous one
+	Levels []SignatureLevel
+}
+
+// SignatureLevel holds hashes of chunks with level chunk size in given ranges of chunk indexes
+type SignatureLevel struct {
+	ChunkSize int
+	Ranges    []ChunkRange
+	// ChunksHashes are hashes of all chunks in ranges, in order of ranges
+	ChunksHashes [][]byte
+}
+
+var (
+	ErrMultiSignatureInvalidLevels = errors.New("signature level must have chunk size dividing previous one and requested ranges")
+	ErrChunkRangesInvalid          = errors.New("chunk ranges must be ordered, non-empty and within data")
+	ErrChunkSizeAboveLimit         = errors.New("chunk size is above MaxChunkSize")
+	ErrSignatureIncomplete         = errors.New("signature is missing hashes of chunks which weren't fetched")
+)
+
+// Finest returns signature with the smallest chunk size, delta calculated by MultiDeltaCalculator is related to it.
+// Hashes of chunks which weren't fetched are nil, so the signature is only usable to apply delta,
+// UpdateSignature and CompareSignatures return ErrSignatureIncomplete for it.
+func (m MultiSignature) Finest() Signature {
+	if len(m.Levels) == 0 {
+		return m.Coarse
+	}
+	level := m.Levels[len(m.Levels)-1]
+	chunksHashes := make([][]byte, chunksCount(m.Coarse.Size, level.ChunkSize))
+	hashes := level.ChunksHashes
+	for _, r := range level.Ranges {
+		n := copy(chunksHashes[r.Start:r.End], hashes)
+		hashes = hashes[n:]
+	}
+	return Signature{
+		ChunkSize:    level.ChunkSize,
+		ChunksHashes: chunksHashes,
+		Size:         m.Coarse.Size,
+		Algorithm:    m.Coarse.Algorithm,
+	}
+}
+
+// SignatureLevelFromReaderAt calculates hashes of chunks in ranges of first size bytes of r,
+// chunk size is usually requested by peer, so it's limited to MaxChunkSize
+func SignatureLevelFromReaderAt(r io.ReaderAt, size int64, chunkSize int, ranges []ChunkRange) (SignatureLevel, error) {
+	if chunkSize <= 0 {
+		return SignatureLevel{}, ErrCalculateSignatureInvalidChunkSize
+	}
+	if chunkSize > MaxChunkSize {
+		return SignatureLevel{}, ErrChunkSizeAboveLimit
+	}
+	if err := validateChunkRanges(ranges, chunksCount(size, chunkSize)); err != nil {
+		return SignatureLevel{}, err
+	}
+
+	hashCalc := newDefaultHashCalculator()
+	buf := make([]byte, mathx.MinInt64(int64(chunkSize), size))
+	chunksHashes := make([][]byte, 0)
+	for _, cr := range ranges {
+		for i := cr.Start; i < cr.End; i++ {
+			offset := int64(i) * int64(chunkSize)
+			chunk := buf[:mathx.MinInt64(int64(chunkSize), size-offset)]
+			if err := iox.ReadFullAt(r, chunk, offset); err != nil {
+				return SignatureLevel{}, err
+			}
+			if _, err := hashCalc.Write(chunk); err != nil {
+				return SignatureLevel{}, err
+			}
+			chunksHashes = append(chunksHashes, hashCalc.Sum(nil))
+			hashCalc.Reset()
+		}
+	}
+
+	return SignatureLevel{
+		ChunkSize:    chunkSize,
+		Ranges:       ranges,
+		ChunksHashes: chunksHashes,
+	}, nil
+}
+
+// returns ErrSignatureIncomplete if signature misses hashes of chunks, like signature returned by MultiSignature.Finest
+func checkSignatureComplete(signature Signature) error {
+	for _, hash := range signature.ChunksHashes {
+		if hash == nil {
+			return ErrSignatureIncomplete
+		}
+	}
+	return nil
+}
+
+// returns number of chunks of data with given size
+func chunksCount(size int64, chunkSize int) int {
+	return int((size + int64(chunkSize) - 1) / int64(chunkSize))
+}
+
+func validateChunkRanges(ranges []ChunkRange, count int) error {
+	previousEnd := 0
+	for _, r := range ranges {
+		if r.Start < previousEnd || r.End <= r.Start || r.End > count {
+			return ErrChunkRangesInvalid
+		}
+		previousEnd = r.End
+	}
+	return nil
+}
+
+func rangesLength(ranges []ChunkRange) int {
+	length := 0
+	for _, r := range ranges {
+		length += r.End - r.Start
+	}
+	return length
+}
@@ -0,0 +1,163 @@
+package rolling_hash_diff
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Encoded signature level starts with header: magic, format version and chunk size, it's followed by number of ranges,
+// ranges encoded as distance from end of the previous range and length, number of hashes and hash records.
+// Level without hashes is used to request hashes of its ranges from original holder.
+var signatureLevelMagic = []byte("RHDL")
+
+const (
+	signatureLevelFormatVersion = 1
+)
+
+// WriteSignatureLevel writes encoded signature level to w
+func WriteSignatureLevel(w io.Writer, level SignatureLevel) error {
+	buf := make([]byte, 0, len(signatureLevelMagic)+1+(2+2*len(level.Ranges))*binary.MaxVarintLen64)
+	buf = append(buf, signatureLevelMagic...)
+	buf = append(buf, signatureLevelFormatVersion)
+	buf = appendUvarint(buf, uint64(level.ChunkSize))
+	buf = appendUvarint(buf, uint64(len(level.Ranges)))
+	previousEnd := 0
+	for _, r := range level.Ranges {
+		buf = appendUvarint(buf, uint64(r.Start-previousEnd))
+		buf = appendUvarint(buf, uint64(r.End-r.Start))
+		previousEnd = r.End
+	}
+	buf = appendUvarint(buf, uint64(len(level.ChunksHashes)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+
+	for _, hash := range level.ChunksHashes {
+		record := appendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(hash)), uint64(len(hash)))
+		if _, err := w.Write(append(record, hash...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSignatureLevel reads encoded signature level from r, it doesn't read from r more than encoded level
+func ReadSignatureLevel(r io.Reader) (SignatureLevel, error) {
+	br := byteReader{r: r}
+
+	magic := make([]byte, len(signatureLevelMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return SignatureLevel{}, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+	}
+	if string(magic) != string(signatureLevelMagic) {
+		return SignatureLevel{}, ErrDecodeSignatureInvalidFormat
+	}
+	version, err := br.ReadByte()
+	if err != nil {
+		return SignatureLevel{}, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+	}
+	if version != signatureLevelFormatVersion {
+		return SignatureLevel{}, ErrDecodeSignatureUnsupportedVersion
+	}
+	chunkSize, err := readInt(br)
+	if err != nil {
+		return SignatureLevel{}, err
+	}
+	if chunkSize > MaxChunkSize {
+		return SignatureLevel{}, ErrDecodeSignatureInvalidFormat
+	}
+
+	rangesCount, err := readInt(br)
+	if err != nil {
+		return SignatureLevel{}, err
+	}
+	// ranges are appended as they are read, so corrupted count doesn't allocate huge slice
+	ranges := make([]ChunkRange, 0)
+	previousEnd := 0
+	for i := 0; i < rangesCount; i++ {
+		distance, err := readInt(br)
+		if err != nil {
+			return SignatureLevel{}, err
+		}
+		length, err := readInt(br)
+		if err != nil {
+			return SignatureLevel{}, err
+		}
+		if length == 0 || distance > maxInt-previousEnd || length > maxInt-previousEnd-distance {
+			return SignatureLevel{}, ErrDecodeSignatureInvalidFormat
+		}
+		start := previousEnd + distance
+		ranges = append(ranges, ChunkRange{Start: start, End: start + length})
+		previousEnd = start + length
+	}
+
+	hashesCount, err := readInt(br)
+	if err != nil {
+		return SignatureLevel{}, err
+	}
+	if hashesCount != 0 && hashesCount != rangesLength(ranges) {
+		return SignatureLevel{}, ErrDecodeSignatureInvalidFormat
+	}
+	chunksHashes := make([][]byte, 0)
+	for i := 0; i < hashesCount; i++ {
+		hashSize, err := binary.ReadUvarint(br)
+		if err != nil {
+			return SignatureLevel{}, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+		}
+		if hashSize > maxHashSize {
+			return SignatureLevel{}, ErrDecodeSignatureInvalidFormat
+		}
+		hash := make([]byte, hashSize)
+		if _, err := io.ReadFull(br, hash); err != nil {
+			return SignatureLevel{}, decodeErr(err, ErrDecodeSignatureInvalidFormat)
+		}
+		chunksHashes = append(chunksHashes, hash)
+	}
+
+	return SignatureLevel{
+		ChunkSize:    chunkSize,
+		Ranges:       ranges,
+		ChunksHashes: chunksHashes,
+	}, nil
+}
+
+// WriteMultiSignature writes encoded coarse signature followed by number of levels and encoded levels to w
+func WriteMultiSignature(w io.Writer, signature MultiSignature) error {
+	if err := WriteSignature(w, signature.Coarse); err != nil {
+		return err
+	}
+	if _, err := w.Write(appendUvarint(nil, uint64(len(signature.Levels)))); err != nil {
+		return err
+	}
+	for _, level := range signature.Levels {
+		if err := WriteSignatureLevel(w, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMultiSignature reads encoded multi signature from r
+func ReadMultiSignature(r io.Reader) (MultiSignature, error) {
+	coarse, err := ReadSignature(r)
+	if err != nil {
+		return MultiSignature{}, err
+	}
+	levelsCount, err := readInt(byteReader{r: r})
+	if err != nil {
+		return MultiSignature{}, err
+	}
+	levels := make([]SignatureLevel, 0)
+	for i := 0; i < levelsCount; i++ {
+		level, err := ReadSignatureLevel(r)
+		if err != nil {
+			return MultiSignature{}, err
+		}
+		levels = append(levels, level)
+	}
+
+	return MultiSignature{
+		Coarse: coarse,
+		Levels: levels,
+	}, nil
+}
@@ -0,0 +1,143 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSignatureLevel_ReadSignatureLevel(t *testing.T) {
+	cases := map[string]struct {
+		given SignatureLevel
+	}{
+		"level with hashes": {
+			given: SignatureLevel{
+				ChunkSize:    4,
+				Ranges:       []ChunkRange{{Start: 2, End: 4}, {Start: 4, End: 5}, {Start: 9, End: 10}},
+				ChunksHashes: [][]byte{bytes.Repeat([]byte{1}, 32), {2}, {}, {4, 4}},
+			},
+		},
+		"request without hashes": {
+			given: SignatureLevel{
+				ChunkSize:    1 << 20,
+				Ranges:       []ChunkRange{{Start: 1 << 30, End: 1<<30 + 7}},
+				ChunksHashes: [][]byte{},
+			},
+		},
+		"no ranges": {
+			given: SignatureLevel{
+				ChunkSize:    2,
+				Ranges:       []ChunkRange{},
+				ChunksHashes: [][]byte{},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			assert.NoError(t, WriteSignatureLevel(buf, c.given))
+			buf.WriteString("rest")
+
+			actual, err := ReadSignatureLevel(buf)
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.given, actual)
+			assert.Equal(t, "rest", buf.String())
+		})
+	}
+}
+
+func TestReadSignatureLevel_Err(t *testing.T) {
+	encoded := &bytes.Buffer{}
+	assert.NoError(t, WriteSignatureLevel(encoded, SignatureLevel{
+		ChunkSize:    2,
+		Ranges:       []ChunkRange{{Start: 1, End: 3}},
+		ChunksHashes: [][]byte{{1}, {2}},
+	}))
+	hugeChunkSize := &bytes.Buffer{}
+	assert.NoError(t, WriteSignatureLevel(hugeChunkSize, SignatureLevel{
+		ChunkSize: MaxChunkSize + 1,
+	}))
+
+	cases := map[string]struct {
+		given       []byte
+		expectedErr error
+	}{
+		"err empty": {
+			given:       []byte{},
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err invalid magic": {
+			given:       []byte("XXXX\x01\x02\x00\x00"),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err unsupported version": {
+			given:       []byte("RHDL\x02\x02\x00\x00"),
+			expectedErr: ErrDecodeSignatureUnsupportedVersion,
+		},
+		"err truncated": {
+			given:       encoded.Bytes()[:encoded.Len()-1],
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err chunk size above limit": {
+			given:       hugeChunkSize.Bytes(),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err empty range": {
+			given:       []byte("RHDL\x01\x02\x01\x01\x00\x00"),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err hashes count not matching ranges": {
+			given:       []byte("RHDL\x01\x02\x01\x01\x02\x01\x01\x01"),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+		"err huge ranges count": {
+			given:       []byte("RHDL\x01\x02\xff\xff\xff\xff\x0f"),
+			expectedErr: ErrDecodeSignatureInvalidFormat,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadSignatureLevel(bytes.NewReader(c.given))
+
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
+
+func TestWriteMultiSignature_ReadMultiSignature(t *testing.T) {
+	given := MultiSignature{
+		Coarse: Signature{
+			ChunkSize:    16,
+			ChunksHashes: [][]byte{{1}, {2}, {3}},
+			Size:         42,
+		},
+		Levels: []SignatureLevel{
+			{
+				ChunkSize:    8,
+				Ranges:       []ChunkRange{{Start: 2, End: 4}},
+				ChunksHashes: [][]byte{{4}, {5}},
+			},
+			{
+				ChunkSize:    4,
+				Ranges:       []ChunkRange{{Start: 4, End: 6}},
+				ChunksHashes: [][]byte{{6}, {7}},
+			},
+		},
+	}
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteMultiSignature(buf, given))
+	buf.WriteString("rest")
+
+	actual, err := ReadMultiSignature(buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, given, actual)
+	assert.Equal(t, "rest", buf.String())
+	assert.Equal(t, Signature{
+		ChunkSize:    4,
+		ChunksHashes: [][]byte{nil, nil, nil, nil, {6}, {7}, nil, nil, nil, nil, nil},
+		Size:         42,
+	}, actual.Finest())
+}
@@ -0,0 +1,131 @@
+package rolling_hash_diff
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/iox"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// ParallelSignatureCalculator calculates signature of data available through io.ReaderAt,
+// chunks are hashed concurrently by many workers and the result is the same as calculated by SignatureCalculator
+type ParallelSignatureCalculator struct {
+	chunkSize         int
+	workers           int
+	newHashCalculator func() HashCalculator
+	options           options
+}
+
+var (
+	ErrCalculateSignatureInvalidChunkSize = errors.New("chunk size must be greater than zero")
+)
+
+// NewParallelSignatureCalculator returns calculator using given number of workers,
+// if workers is less than 1 number of available CPUs is used. Progress is reported by workers as chunks are hashed,
+// chunk hashes are passed to WithChunkHashHandler in order once all of them are calculated.
+func NewParallelSignatureCalculator(chunkSize, workers int, opts ...Option) ParallelSignatureCalculator {
+	return newParallelSignatureCalculator(chunkSize, workers, newDefaultHashCalculator, opts...)
+}
+
+func newParallelSignatureCalculator(chunkSize, workers int, newHashCalc func() HashCalculator, opts ...Option) ParallelSignatureCalculator {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	return ParallelSignatureCalculator{
+		chunkSize:         chunkSize,
+		workers:           workers,
+		newHashCalculator: newHashCalc,
+		options:           newOptions(opts),
+	}
+}
+
+// Signature calculates signature of first size bytes of r, it's safe to call this method concurrently
+func (p ParallelSignatureCalculator) Signature(r io.ReaderAt, size int64) (Signature, error) {
+	if p.chunkSize <= 0 {
+		return Signature{}, ErrCalculateSignatureInvalidChunkSize
+	}
+
+	chunkSize := int64(p.chunkSize)
+	chunksCount := int((size + chunkSize - 1) / chunkSize)
+	if chunksCount < 2 {
+		if p.options.smallInput {
+			return EmptySignature(p.chunkSize), nil
+		}
+		return Signature{}, ErrCalculateSignatureInsufficientData
+	}
+
+	chunksHashes := make([][]byte, chunksCount)
+	progress := newSharedProgressReporter(p.options)
+	jobs := make(chan int)
+	done := make(chan struct{})
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			close(done)
+		})
+	}
+
+	workers := mathx.Min(p.workers, chunksCount)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			hashCalc := p.newHashCalculator()
+			buf := make([]byte, p.chunkSize)
+			for i := range jobs {
+				offset := int64(i) * chunkSize
+				chunk := buf[:mathx.Min(p.chunkSize, int(size-offset))]
+				if err := iox.ReadFullAt(r, chunk, offset); err != nil {
+					fail(err)
+					return
+				}
+				if _, err := hashCalc.Write(chunk); err != nil {
+					fail(err)
+					return
+				}
+				chunksHashes[i] = hashCalc.Sum(nil)
+				hashCalc.Reset()
+				progress.addChunkHashed(len(chunk))
+			}
+		}()
+	}
+
+dispatch:
+	for i := 0; i < chunksCount; i++ {
+		select {
+		case jobs <- i:
+		case <-done:
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return Signature{}, firstErr
+	}
+	if handler := p.options.chunkHashHandler; handler != nil {
+		for _, hash := range chunksHashes {
+			if err := handler(hash); err != nil {
+				return Signature{}, err
+			}
+		}
+	}
+	progress.finish()
+
+	return Signature{
+		ChunkSize:    p.chunkSize,
+		ChunksHashes: chunksHashes,
+		Size:         size,
+	}, nil
+}
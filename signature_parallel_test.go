@@ -0,0 +1,112 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelSignatureCalculator_Signature(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	cases := map[string]struct {
+		givenChunkSize int
+		givenWorkers   int
+		givenData      []byte
+	}{
+		"one worker": {
+			givenChunkSize: 10,
+			givenWorkers:   1,
+			givenData:      data,
+		},
+		"many workers, last chunk partial": {
+			givenChunkSize: 64,
+			givenWorkers:   4,
+			givenData:      data,
+		},
+		"more workers than chunks": {
+			givenChunkSize: 400,
+			givenWorkers:   8,
+			givenData:      data,
+		},
+		"default workers": {
+			givenChunkSize: 3,
+			givenWorkers:   0,
+			givenData:      data,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			seq := NewSignatureCalculator(c.givenChunkSize)
+			_, err := seq.Write(c.givenData)
+			assert.NoError(t, err)
+			expected, err := seq.Signature()
+			assert.NoError(t, err)
+
+			p := NewParallelSignatureCalculator(c.givenChunkSize, c.givenWorkers)
+			actual, err := p.Signature(bytes.NewReader(c.givenData), int64(len(c.givenData)))
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestParallelSignatureCalculator_Signature_Err(t *testing.T) {
+	errRead := errors.New("read failed")
+
+	cases := map[string]struct {
+		givenChunkSize int
+		givenReader    io.ReaderAt
+		givenSize      int64
+		expectedErr    error
+	}{
+		"err insufficient data, one chunk": {
+			givenChunkSize: 10,
+			givenReader:    bytes.NewReader([]byte{1, 2}),
+			givenSize:      2,
+			expectedErr:    ErrCalculateSignatureInsufficientData,
+		},
+		"err invalid chunk size": {
+			givenChunkSize: 0,
+			givenReader:    bytes.NewReader([]byte{1, 2}),
+			givenSize:      2,
+			expectedErr:    ErrCalculateSignatureInvalidChunkSize,
+		},
+		"err size greater than data": {
+			givenChunkSize: 2,
+			givenReader:    bytes.NewReader([]byte{1, 2, 3}),
+			givenSize:      6,
+			expectedErr:    io.ErrUnexpectedEOF,
+		},
+		"err read": {
+			givenChunkSize: 2,
+			givenReader:    failingReaderAt{err: errRead},
+			givenSize:      6,
+			expectedErr:    errRead,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := NewParallelSignatureCalculator(c.givenChunkSize, 2)
+			actual, err := p.Signature(c.givenReader, c.givenSize)
+
+			assert.Equal(t, Signature{}, actual)
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
+
+type failingReaderAt struct {
+	err error
+}
+
+func (r failingReaderAt) ReadAt([]byte, int64) (int, error) {
+	return 0, r.err
+}
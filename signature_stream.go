@@ -0,0 +1,129 @@
+package rolling_hash_diff
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// StreamingSignature is origin signature received chunk by chunk. DeltaCalculator created from it
+// starts before the whole signature is known and waits only when it needs chunks which weren't received yet,
+// calculated delta is the same as calculated against the complete signature.
+// It's safe to append chunks while calculators use it.
+type StreamingSignature struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	chunkSize   int
+	chunks      map[string][]int
+	chunksCount int
+	closed      bool
+	err         error
+}
+
+var (
+	ErrStreamingSignatureClosed = errors.New("streaming signature is closed")
+)
+
+func NewStreamingSignature(chunkSize int) *StreamingSignature {
+	s := &StreamingSignature{
+		chunkSize: chunkSize,
+		chunks:    make(map[string][]int),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *StreamingSignature) ChunkSize() int {
+	return s.chunkSize
+}
+
+// Append adds hash of the next origin chunk
+func (s *StreamingSignature) Append(hash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStreamingSignatureClosed
+	}
+	s.chunks[string(hash)] = append(s.chunks[string(hash)], s.chunksCount)
+	s.chunksCount++
+	s.cond.Broadcast()
+	return nil
+}
+
+// Close marks signature as complete
+func (s *StreamingSignature) Close() {
+	s.CloseWithError(nil)
+}
+
+// CloseWithError marks signature as broken, calculators waiting for chunks return given error
+func (s *StreamingSignature) CloseWithError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	s.cond.Broadcast()
+}
+
+// ReadFrom appends all chunks hashes read from decoder and closes signature,
+// signature is closed with error if decoding fails
+func (s *StreamingSignature) ReadFrom(d *SignatureDecoder) error {
+	for {
+		hash, err := d.Next()
+		if err == io.EOF {
+			s.Close()
+			return nil
+		}
+		if err != nil {
+			s.CloseWithError(err)
+			return err
+		}
+		if err := s.Append(hash); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *StreamingSignature) nextChunkIndex(hash []byte, after int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		// indexes of appended chunks are growing, so the first found is final
+		if i := nextChunkIndex(s.chunks[string(hash)], after); i != -1 {
+			return i, nil
+		}
+		if s.closed {
+			return -1, s.err
+		}
+		s.cond.Wait()
+	}
+}
+
+func (s *StreamingSignature) hasChunk(index int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for index >= s.chunksCount && !s.closed {
+		s.cond.Wait()
+	}
+	if index < s.chunksCount {
+		return true, nil
+	}
+	return false, s.err
+}
+
+func (s *StreamingSignature) totalChunks() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for !s.closed {
+		s.cond.Wait()
+	}
+	return s.chunksCount, s.err
+}
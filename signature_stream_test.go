@@ -0,0 +1,90 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDeltaCalculatorFromStream(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEEEEFF")
+
+	cases := map[string]struct {
+		givenUpdated []byte
+	}{
+		"equal data": {
+			givenUpdated: original,
+		},
+		"added and deleted": {
+			givenUpdated: []byte("XXXXAAAACCCCYYYYEEEEFFZZ"),
+		},
+		"matching only the last chunk": {
+			givenUpdated: []byte("XXXXFF"),
+		},
+		"suffix after end of origin": {
+			givenUpdated: []byte("AAAABBBBCCCCDDDDEEEEFFXXXXYY"),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			expected, err := DeltaFromReader(bytes.NewReader(c.givenUpdated), mustSignature(t, original, 4))
+			assert.NoError(t, err)
+
+			// signature is calculated, encoded, decoded and used by delta calculator at the same time
+			pr, pw := io.Pipe()
+			go func() {
+				e := NewSignatureEncoder(pw, 4, AlgorithmSHA256)
+				calc := NewSignatureCalculator(4, WithChunkHashHandler(e.WriteChunkHash))
+				_, err := calc.Write(original)
+				if err == nil {
+					var signature Signature
+					signature, err = calc.Signature()
+					if err == nil {
+						err = e.Close(signature.Size)
+					}
+				}
+				pw.CloseWithError(err)
+			}()
+
+			d, err := NewSignatureDecoder(pr)
+			assert.NoError(t, err)
+			origin := NewStreamingSignature(d.ChunkSize())
+			go origin.ReadFrom(d)
+
+			calc := NewDeltaCalculatorFromStream(origin)
+			_, err = calc.Write(c.givenUpdated)
+			assert.NoError(t, err)
+			actual, err := calc.Delta()
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestNewDeltaCalculatorFromStream_Err(t *testing.T) {
+	errBroken := errors.New("broken stream")
+
+	origin := NewStreamingSignature(2)
+	assert.NoError(t, origin.Append([]byte{1}))
+
+	go origin.CloseWithError(errBroken)
+
+	calc := NewDeltaCalculatorFromStream(origin)
+	_, err := calc.Write([]byte{1, 2, 3, 4})
+	if err == nil {
+		_, err = calc.Delta()
+	}
+
+	assert.Equal(t, errBroken, err)
+	assert.Equal(t, ErrStreamingSignatureClosed, origin.Append([]byte{2}))
+}
+
+func mustSignature(t *testing.T, data []byte, chunkSize int) Signature {
+	signature, err := SignatureFromReader(bytes.NewReader(data), chunkSize)
+	assert.NoError(t, err)
+	return signature
+}
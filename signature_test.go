@@ -1,6 +1,7 @@
 package rolling_hash_diff
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -35,6 +36,7 @@ func TestSignatureCalculator_Signature(t *testing.T) {
 					{11},
 					{22},
 				},
+				Size: 3,
 			},
 		},
 		"ok, chunk size = 3, one write": {
@@ -57,6 +59,7 @@ func TestSignatureCalculator_Signature(t *testing.T) {
 					{111},
 					{222},
 				},
+				Size: 4,
 			},
 		},
 		"ok, chunk size = 2, many writes": {
@@ -86,6 +89,7 @@ func TestSignatureCalculator_Signature(t *testing.T) {
 					{22},
 					{33},
 				},
+				Size: 5,
 			},
 		},
 		"err insufficient data, no writes, zero chunks": {
@@ -150,3 +154,34 @@ func (m *signatureCalculatorMock) Sum([]byte) []byte {
 func (m *signatureCalculatorMock) Reset() {
 	m.Called()
 }
+
+func TestSignature_SmallInput(t *testing.T) {
+	cases := map[string]struct {
+		givenData []byte
+	}{
+		"no data": {
+			givenData: []byte{},
+		},
+		"one chunk": {
+			givenData: []byte("AAAA"),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := SignatureFromReader(bytes.NewReader(c.givenData), 4, WithSmallInput())
+			assert.NoError(t, err)
+			assert.Equal(t, EmptySignature(4), actual)
+
+			actual, err = NewParallelSignatureCalculator(4, 2, WithSmallInput()).Signature(bytes.NewReader(c.givenData), int64(len(c.givenData)))
+			assert.NoError(t, err)
+			assert.Equal(t, EmptySignature(4), actual)
+
+			// delta against empty signature contains whole data and doesn't need original
+			delta, err := DeltaFromReader(bytes.NewReader([]byte("BBBBBB")), actual)
+			assert.NoError(t, err)
+			updated := &bytes.Buffer{}
+			assert.NoError(t, Apply(updated, bytes.NewReader(c.givenData), actual, delta))
+			assert.Equal(t, "BBBBBB", updated.String())
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package rolling_hash_diff
+
+import (
+	"io"
+	"sort"
+
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/iox"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+// UpdateSignature derives signature of updated data from origin signature and delta calculated against it.
+// Hashes of origin chunks copied to chunk positions of updated data are reused, only chunks containing
+// literal data from delta are read from updated and hashed, so re-signing after small change is cheap.
+func UpdateSignature(originSignature Signature, delta Delta, updated io.ReaderAt) (Signature, error) {
+	return updateSignature(originSignature, delta, updated, newDefaultHashCalculator())
+}
+
+func updateSignature(originSignature Signature, delta Delta, updated io.ReaderAt, hashCalc HashCalculator) (Signature, error) {
+	if err := checkSignatureComplete(originSignature); err != nil {
+		return Signature{}, err
+	}
+	segments, err := deltaLayout(originSignature, delta)
+	if err != nil {
+		return Signature{}, err
+	}
+
+	size := layoutSize(segments)
+	chunkSize := int64(originSignature.ChunkSize)
+	chunksCount := int((size + chunkSize - 1) / chunkSize)
+	if chunksCount < 2 {
+		return Signature{}, ErrCalculateSignatureInsufficientData
+	}
+
+	chunksHashes := make([][]byte, chunksCount)
+	chunk := make([]byte, chunkSize)
+	for i := range chunksHashes {
+		offset := int64(i) * chunkSize
+		length := mathx.MinInt64(chunkSize, size-offset)
+
+		// reuse hash if the chunk is exactly one copied origin chunk
+		s := segments[sort.Search(len(segments), func(j int) bool {
+			return segments[j].offset+segments[j].length > offset
+		})]
+		if s.isCopy() && s.offset == offset && s.length == length {
+			chunksHashes[i] = originSignature.ChunksHashes[s.chunkIndex]
+			continue
+		}
+
+		if err := iox.ReadFullAt(updated, chunk[:length], offset); err != nil {
+			return Signature{}, err
+		}
+		if _, err := hashCalc.Write(chunk[:length]); err != nil {
+			return Signature{}, err
+		}
+		chunksHashes[i] = hashCalc.Sum(nil)
+		hashCalc.Reset()
+	}
+
+	return Signature{
+		ChunkSize:    originSignature.ChunkSize,
+		ChunksHashes: chunksHashes,
+		Size:         size,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package rolling_hash_diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateSignature(t *testing.T) {
+	cases := map[string]struct {
+		mock          func(*signatureCalculatorMock)
+		givenOrigin   Signature
+		givenDelta    Delta
+		givenUpdated  []byte
+		expected      Signature
+		expectedError error
+	}{
+		"aligned literal, only literal hashed": {
+			mock: func(m *signatureCalculatorMock) {
+				m.On("Write", []byte{9, 9}).Once()
+				m.On("Sum", nil).Return([]byte{99}).Once()
+				m.On("Reset").Once()
+			},
+			givenOrigin: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}, {3}},
+				Size:         6,
+			},
+			givenDelta: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeAddition, ChunkIndex: 1, Data: []byte{9, 9}},
+				},
+			},
+			givenUpdated: []byte{1, 1, 9, 9, 2, 2, 3, 3},
+			expected: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {99}, {2}, {3}},
+				Size:         8,
+			},
+		},
+		"unaligned literal, straddling chunks hashed": {
+			mock: func(m *signatureCalculatorMock) {
+				m.On("Write", []byte{9, 2}).Once()
+				m.On("Sum", nil).Return([]byte{92}).Once()
+				m.On("Reset").Once()
+
+				m.On("Write", []byte{2, 3}).Once()
+				m.On("Sum", nil).Return([]byte{23}).Once()
+				m.On("Reset").Once()
+
+				m.On("Write", []byte{3}).Once()
+				m.On("Sum", nil).Return([]byte{33}).Once()
+				m.On("Reset").Once()
+			},
+			givenOrigin: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}, {3}},
+				Size:         6,
+			},
+			givenDelta: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeAddition, ChunkIndex: 1, Data: []byte{9}},
+				},
+			},
+			givenUpdated: []byte{1, 1, 9, 2, 2, 3, 3},
+			expected: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {92}, {23}, {33}},
+				Size:         7,
+			},
+		},
+		"deleted chunks, last partial chunk reused": {
+			mock: func(m *signatureCalculatorMock) {},
+			givenOrigin: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}, {3}},
+				Size:         5,
+			},
+			givenDelta: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 1},
+				},
+			},
+			givenUpdated: []byte{1, 1, 3},
+			expected: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {3}},
+				Size:         3,
+			},
+		},
+		"err insufficient data": {
+			mock: func(m *signatureCalculatorMock) {},
+			givenOrigin: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}},
+				Size:         4,
+			},
+			givenDelta: Delta{
+				Operations: []DeltaOperation{
+					{Type: OperationTypeDeletion, ChunkIndex: 1},
+				},
+			},
+			givenUpdated:  []byte{1, 1},
+			expectedError: ErrCalculateSignatureInsufficientData,
+		},
+		"err invalid signature size": {
+			mock: func(m *signatureCalculatorMock) {},
+			givenOrigin: Signature{
+				ChunkSize:    2,
+				ChunksHashes: [][]byte{{1}, {2}},
+			},
+			givenDelta:    Delta{},
+			givenUpdated:  []byte{1, 1, 2, 2},
+			expectedError: ErrSignatureInvalidSize,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := &signatureCalculatorMock{}
+			c.mock(m)
+
+			actual, err := updateSignature(c.givenOrigin, c.givenDelta, bytes.NewReader(c.givenUpdated), m)
+
+			assert.Equal(t, c.expected, actual)
+			assert.Equal(t, c.expectedError, err)
+
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateSignature_EqualToCalculated(t *testing.T) {
+	original := []byte("AAAABBBBCCCCDDDDEEEEFF")
+	updated := []byte("AAAAXXBBBBCCCCEEEEFFZZZZZ")
+
+	originSignature, err := SignatureFromReader(bytes.NewReader(original), 4)
+	assert.NoError(t, err)
+	delta, err := DeltaFromReader(bytes.NewReader(updated), originSignature)
+	assert.NoError(t, err)
+	expected, err := SignatureFromReader(bytes.NewReader(updated), 4)
+	assert.NoError(t, err)
+
+	actual, err := UpdateSignature(originSignature, delta, bytes.NewReader(updated))
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,338 @@
+// Package store keeps version history of named objects on filesystem, similar to rdiff-backup.
+//
+// The latest version of object is kept as full snapshot and older versions as reverse deltas against versions
+// following them, so storing new version replaces the latest snapshot with delta. Every SnapshotInterval-th version
+// keeps its snapshot, which bounds number of deltas applied to reconstruct any version. Versions are kept as files
+// dir/name/{version}.snapshot and dir/name/{version}.rhdx with deltas in seekable format.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+)
+
+const (
+	// DefaultSnapshotInterval is used if snapshot interval is not configured
+	DefaultSnapshotInterval = 10
+
+	snapshotSuffix = ".snapshot"
+	deltaSuffix    = ".rhdx"
+)
+
+var (
+	ErrInvalidName     = errors.New("invalid object name")
+	ErrVersionNotFound = errors.New("version not found")
+	ErrMissingSnapshot = errors.New("no snapshot to reconstruct version from")
+	ErrInvalidKeep     = errors.New("at least one version has to be kept")
+)
+
+// Config configures Store, zero values are replaced with defaults
+type Config struct {
+	// ChunkSize of signatures which reverse deltas are calculated against, rolling.DefaultChunkSize is used if it's not set
+	ChunkSize int
+	// SnapshotInterval is interval of version numbers which keep full snapshots, 1 keeps snapshots of all versions
+	SnapshotInterval int
+}
+
+// Store keeps versions of named objects in directory, it's safe for concurrent use by single process
+type Store struct {
+	dir              string
+	chunkSize        int
+	snapshotInterval uint64
+
+	mu sync.RWMutex
+}
+
+// Version describes stored object version
+type Version struct {
+	// Number of version, versions of object are numbered from 1 in order they were stored
+	Number uint64
+	// Snapshot is true if version is kept as full data, otherwise it's kept as reverse delta
+	Snapshot bool
+	// StoredSize is size of snapshot or reverse delta of version
+	StoredSize int64
+}
+
+// New returns store keeping objects in dir, which is created with the first stored version
+func New(dir string, config Config) *Store {
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = rolling.DefaultChunkSize
+	}
+	if config.SnapshotInterval <= 0 {
+		config.SnapshotInterval = DefaultSnapshotInterval
+	}
+	return &Store{
+		dir:              dir,
+		chunkSize:        config.ChunkSize,
+		snapshotInterval: uint64(config.SnapshotInterval),
+	}
+}
+
+// Put stores all data read from r as new latest version of object and returns its number,
+// nothing is stored if reading r fails
+func (s *Store) Put(name string, r io.Reader) (uint64, error) {
+	dir, err := s.objectDir(name)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	versions, err := listVersions(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := writeTemp(dir, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(data)
+
+	number := uint64(1)
+	replacesSnapshot := false
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1].Number
+		number = latest + 1
+		if latest%s.snapshotInterval != 0 {
+			if err := s.writeDelta(dir, latest, data); err != nil {
+				return 0, err
+			}
+			replacesSnapshot = true
+		}
+	}
+
+	if err := os.Rename(data, versionPath(dir, number, snapshotSuffix)); err != nil {
+		return 0, err
+	}
+	if replacesSnapshot {
+		// snapshot kept next to delta after failure is still valid, it's preferred by Get
+		if err := os.Remove(versionPath(dir, number-1, snapshotSuffix)); err != nil {
+			return 0, err
+		}
+	}
+	return number, nil
+}
+
+// Get writes data of object version to w, versions kept as deltas are reconstructed from the nearest following
+// snapshot and rolling.ErrApplyChecksumMismatch is returned if reconstructed data doesn't match
+func (s *Store) Get(name string, version uint64, w io.Writer) error {
+	dir, err := s.objectDir(name)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions, err := listVersions(dir)
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].Number >= version })
+	if i == len(versions) || versions[i].Number != version {
+		return ErrVersionNotFound
+	}
+	j := i
+	for j < len(versions) && !versions[j].Snapshot {
+		j++
+	}
+	if j == len(versions) {
+		return ErrMissingSnapshot
+	}
+
+	snapshot, err := os.Open(versionPath(dir, versions[j].Number, snapshotSuffix))
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	if i == j {
+		_, err := io.Copy(w, snapshot)
+		return err
+	}
+
+	// deltas are chained lazily, so reads of the oldest version are mapped through all of them
+	var data io.ReaderAt = snapshot
+	var delta *rolling.SeekableDelta
+	for k := j - 1; k >= i; k-- {
+		f, err := os.Open(versionPath(dir, versions[k].Number, deltaSuffix))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		delta, err = rolling.OpenSeekableDelta(f)
+		if err != nil {
+			return err
+		}
+		data = delta.NewReader(data)
+	}
+
+	checksum := rolling.NewChecksumCalculator()
+	if _, err := io.Copy(io.MultiWriter(w, checksum), io.NewSectionReader(data, 0, delta.Size())); err != nil {
+		return err
+	}
+	if string(checksum.Sum(nil)) != string(delta.Checksum()) {
+		return rolling.ErrApplyChecksumMismatch
+	}
+	return nil
+}
+
+// List returns versions of object ordered by number, returned error satisfies os.IsNotExist if object doesn't exist
+func (s *Store) List(name string) ([]Version, error) {
+	dir, err := s.objectDir(name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return listVersions(dir)
+}
+
+// Prune removes all versions of object except the latest keep versions, the oldest versions are removed first,
+// so versions left after failure can still be reconstructed
+func (s *Store) Prune(name string, keep int) error {
+	if keep < 1 {
+		return ErrInvalidKeep
+	}
+	dir, err := s.objectDir(name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, err := listVersions(dir)
+	if err != nil {
+		return err
+	}
+	if len(versions) <= keep {
+		return nil
+	}
+	for _, v := range versions[:len(versions)-keep] {
+		for _, suffix := range []string{deltaSuffix, snapshotSuffix} {
+			if err := os.Remove(versionPath(dir, v.Number, suffix)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writes reverse delta of version against data of following version in file at given path
+func (s *Store) writeDelta(dir string, version uint64, updatedPath string) error {
+	updated, err := os.Open(updatedPath)
+	if err != nil {
+		return err
+	}
+	defer updated.Close()
+	signature, err := rolling.SignatureFromReader(updated, s.chunkSize, rolling.WithSmallInput())
+	if err != nil {
+		return err
+	}
+
+	original, err := os.Open(versionPath(dir, version, snapshotSuffix))
+	if err != nil {
+		return err
+	}
+	defer original.Close()
+	delta, err := rolling.DeltaFromReader(original, signature)
+	if err != nil {
+		return err
+	}
+
+	path, err := writeTemp(dir, func(w io.Writer) error {
+		return rolling.WriteSeekableDelta(w, signature, delta)
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	return os.Rename(path, versionPath(dir, version, deltaSuffix))
+}
+
+func (s *Store) objectDir(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", ErrInvalidName
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// returns versions kept in object directory ordered by number, version with both files is kept as snapshot
+func listVersions(dir string) ([]Version, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byNumber := make(map[uint64]Version)
+	for _, f := range files {
+		name := f.Name()
+		suffix := filepath.Ext(name)
+		if strings.HasPrefix(name, ".") || suffix != snapshotSuffix && suffix != deltaSuffix {
+			continue
+		}
+		number, err := strconv.ParseUint(strings.TrimSuffix(name, suffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		v, ok := byNumber[number]
+		if ok && v.Snapshot {
+			continue
+		}
+		byNumber[number] = Version{
+			Number:     number,
+			Snapshot:   suffix == snapshotSuffix,
+			StoredSize: f.Size(),
+		}
+	}
+
+	versions := make([]Version, 0, len(byNumber))
+	for _, v := range byNumber {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Number < versions[j].Number
+	})
+	return versions, nil
+}
+
+func versionPath(dir string, version uint64, suffix string) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", version, suffix))
+}
+
+// writes data with write function to synced temporary file in dir and returns its path,
+// file is removed if write fails
+func writeTemp(dir string, write func(w io.Writer) error) (string, error) {
+	f, err := ioutil.TempFile(dir, ".tmp")
+	if err != nil {
+		return "", err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
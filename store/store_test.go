@@ -0,0 +1,158 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/stretchr/testify/assert"
+)
+
+// returns versions of data with chunks changed, added and deleted in each version
+func testVersions(count int) [][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 4096)
+	rnd.Read(data)
+
+	versions := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		versions = append(versions, data)
+		updated := append([]byte{}, data...)
+		offset := rnd.Intn(len(updated)/64) * 64
+		switch i % 3 {
+		case 0:
+			rnd.Read(updated[offset : offset+64])
+		case 1:
+			added := make([]byte, 128)
+			rnd.Read(added)
+			updated = append(updated[:offset], append(added, data[offset:]...)...)
+		case 2:
+			updated = append(updated[:offset], data[offset+64:]...)
+		}
+		data = updated
+	}
+	return versions
+}
+
+func TestStore(t *testing.T) {
+	cases := map[string]struct {
+		givenConfig       Config
+		givenVersions     int
+		givenKeep         int
+		expectedSnapshots []uint64
+		// test data is smaller than default chunk size, so with default config deltas contain whole versions
+		expectedMaxDeltaSize int64
+	}{
+		"default config": {
+			givenVersions:        12,
+			givenKeep:            12,
+			expectedSnapshots:    []uint64{10, 12},
+			expectedMaxDeltaSize: 8192,
+		},
+		"periodic snapshots": {
+			givenConfig:          Config{ChunkSize: 64, SnapshotInterval: 4},
+			givenVersions:        10,
+			givenKeep:            10,
+			expectedSnapshots:    []uint64{4, 8, 10},
+			expectedMaxDeltaSize: 1024,
+		},
+		"snapshots of all versions": {
+			givenConfig:          Config{ChunkSize: 64, SnapshotInterval: 1},
+			givenVersions:        3,
+			givenKeep:            3,
+			expectedSnapshots:    []uint64{1, 2, 3},
+			expectedMaxDeltaSize: 1024,
+		},
+		"pruned": {
+			givenConfig:          Config{ChunkSize: 64, SnapshotInterval: 4},
+			givenVersions:        10,
+			givenKeep:            5,
+			expectedSnapshots:    []uint64{8, 10},
+			expectedMaxDeltaSize: 1024,
+		},
+		"pruned to latest": {
+			givenConfig:          Config{ChunkSize: 64, SnapshotInterval: 4},
+			givenVersions:        10,
+			givenKeep:            1,
+			expectedSnapshots:    []uint64{10},
+			expectedMaxDeltaSize: 1024,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "store")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			s := New(dir, c.givenConfig)
+			versions := testVersions(c.givenVersions)
+			for i, data := range versions {
+				number, err := s.Put("object", bytes.NewReader(data))
+				assert.NoError(t, err)
+				assert.Equal(t, uint64(i+1), number)
+			}
+			assert.NoError(t, s.Prune("object", c.givenKeep))
+
+			listed, err := s.List("object")
+			assert.NoError(t, err)
+			assert.Len(t, listed, c.givenKeep)
+			snapshots := make([]uint64, 0)
+			for i, v := range listed {
+				assert.Equal(t, uint64(c.givenVersions-c.givenKeep+i+1), v.Number)
+				if v.Snapshot {
+					snapshots = append(snapshots, v.Number)
+				} else {
+					assert.LessOrEqual(t, v.StoredSize, c.expectedMaxDeltaSize)
+				}
+			}
+			assert.Equal(t, c.expectedSnapshots, snapshots)
+
+			for _, v := range listed {
+				data := &bytes.Buffer{}
+				assert.NoError(t, s.Get("object", v.Number, data))
+				assert.Equal(t, versions[v.Number-1], data.Bytes())
+			}
+
+			number, err := s.Put("object", bytes.NewReader([]byte{}))
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(c.givenVersions+1), number)
+			data := &bytes.Buffer{}
+			assert.NoError(t, s.Get("object", number-1, data))
+			assert.Equal(t, versions[len(versions)-1], data.Bytes())
+		})
+	}
+}
+
+func TestStore_Err(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := New(dir, Config{ChunkSize: 64})
+	for _, data := range testVersions(3) {
+		_, err := s.Put("object", bytes.NewReader(data))
+		assert.NoError(t, err)
+	}
+
+	_, err = s.Put("../object", bytes.NewReader([]byte("data")))
+	assert.Equal(t, ErrInvalidName, err)
+	_, err = s.List("missing")
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, ErrVersionNotFound, s.Get("object", 4, &bytes.Buffer{}))
+	assert.Equal(t, ErrInvalidKeep, s.Prune("object", 0))
+
+	// corrupted literal data of delta is detected by checksum
+	path := filepath.Join(dir, "object", "00000000000000000001"+deltaSuffix)
+	delta, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	delta[len(delta)-1] ^= 0xff
+	assert.NoError(t, ioutil.WriteFile(path, delta, 0644))
+	assert.Equal(t, rolling.ErrApplyChecksumMismatch, s.Get("object", 1, &bytes.Buffer{}))
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "object", "00000000000000000003"+snapshotSuffix)))
+	assert.Equal(t, ErrMissingSnapshot, s.Get("object", 2, &bytes.Buffer{}))
+}
@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Every message of the protocol is sent as frame: type (1 byte), payload length (uint32, big endian) and payload.
+// Signature and delta are streamed as sequence of data frames of the same type terminated by empty frame.
+type frameType byte
+
+const (
+	frameHello     frameType = 1
+	frameAccept    frameType = 2
+	frameSignature frameType = 3
+	frameDelta     frameType = 4
+	frameDone      frameType = 5
+	frameError     frameType = 6
+)
+
+const (
+	frameHeaderSize = 5
+	// maximal payload of frame written by this package
+	maxFramePayload = 64 * 1024
+	// maximal payload of frame accepted from peer
+	maxReadFramePayload = 1 << 20
+)
+
+var (
+	ErrUnexpectedFrame = errors.New("unexpected protocol frame")
+	ErrFrameTooLarge   = errors.New("protocol frame too large")
+)
+
+// RemoteError is error reported by the peer
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error: %s", e.Message)
+}
+
+func writeFrame(w io.Writer, t frameType, payload []byte) error {
+	header := make([]byte, frameHeaderSize)
+	header[0] = byte(t)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// reads frame of expected type, error frame is returned as *RemoteError
+func readFrame(r io.Reader, expected frameType) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxReadFramePayload {
+		return nil, ErrFrameTooLarge
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	t := frameType(header[0])
+	if t == frameError {
+		return nil, &RemoteError{Message: string(payload)}
+	}
+	if t != expected {
+		return nil, ErrUnexpectedFrame
+	}
+	return payload, nil
+}
+
+// frameWriter splits written data into frames of given type, Close writes terminating empty frame
+type frameWriter struct {
+	w io.Writer
+	t frameType
+}
+
+func (f frameWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := len(p) - written
+		if n > maxFramePayload {
+			n = maxFramePayload
+		}
+		if err := writeFrame(f.w, f.t, p[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func (f frameWriter) Close() error {
+	return writeFrame(f.w, f.t, nil)
+}
+
+// frameReader reads data from frames of given type until terminating empty frame
+type frameReader struct {
+	r       io.Reader
+	t       frameType
+	payload []byte
+	done    bool
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for len(f.payload) == 0 {
+		if f.done {
+			return 0, io.EOF
+		}
+		payload, err := readFrame(f.r, f.t)
+		if err != nil {
+			return 0, err
+		}
+		if len(payload) == 0 {
+			f.done = true
+		}
+		f.payload = payload
+	}
+	n := copy(p, f.payload)
+	f.payload = f.payload[n:]
+	return n, nil
+}
+
+// reads remaining data until terminating frame, so the next frame can be read
+func (f *frameReader) drain() error {
+	_, err := io.Copy(ioutil.Discard, f)
+	return err
+}
@@ -0,0 +1,285 @@
+// Package sync implements rsync-like protocol synchronizing data over any io.ReadWriter,
+// e.g. TCP connection, Unix socket or SSH stdin/stdout.
+//
+// Receiver has basis data and wants to get updated data from sender:
+//
+//	receiver -> sender: hello with supported protocol versions and chunk sizes
+//	sender -> receiver: accept with negotiated protocol version and chunk size
+//	receiver -> sender: signature of basis data
+//	sender -> receiver: delta of updated data
+//	receiver -> sender: done after delta is applied and verified
+//
+// Any side can send error frame instead of expected frame, it's returned by the other side as *RemoteError.
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+)
+
+const (
+	// ProtocolVersion is the newest protocol version supported by this package
+	ProtocolVersion = 1
+	// MinProtocolVersion is the oldest protocol version supported by this package
+	MinProtocolVersion = 1
+)
+
+// Config configures chunk size negotiation, zero values mean defaults
+type Config struct {
+	// ChunkSize is chunk size proposed by receiver, it's limited to range accepted by both sides,
+	// rolling.DefaultChunkSize is proposed if it's not set
+	ChunkSize int
+	// MinChunkSize and MaxChunkSize are limits of chunk size accepted by the side, zero MinChunkSize means
+	// no limit and zero MaxChunkSize means rolling.MaxChunkSize, so peer can't force huge allocations
+	MinChunkSize int
+	MaxChunkSize int
+}
+
+func (c Config) maxChunkSize() int {
+	if c.MaxChunkSize <= 0 {
+		return rolling.MaxChunkSize
+	}
+	return c.MaxChunkSize
+}
+
+var (
+	ErrVersionMismatch   = errors.New("no common protocol version")
+	ErrChunkSizeMismatch = errors.New("no common chunk size")
+	ErrMissingChecksum   = errors.New("delta doesn't contain checksum")
+)
+
+type hello struct {
+	minVersion   uint64
+	maxVersion   uint64
+	chunkSize    uint64
+	minChunkSize uint64
+	maxChunkSize uint64
+}
+
+type accept struct {
+	version   uint64
+	chunkSize uint64
+}
+
+// Receive receives updated data from sender and writes it to out, basis is read twice: to calculate signature
+// and to apply delta. Context cancels computations but not blocked reads and writes of rw, close rw to stop them.
+func Receive(ctx context.Context, rw io.ReadWriter, basis io.ReadSeeker, out io.Writer, config Config) error {
+	chunkSize := config.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = rolling.DefaultChunkSize
+	}
+	err := writeFrame(rw, frameHello, encodeUvarints(
+		MinProtocolVersion,
+		ProtocolVersion,
+		uint64(chunkSize),
+		uint64(config.MinChunkSize),
+		uint64(config.maxChunkSize()),
+	))
+	if err != nil {
+		return err
+	}
+
+	payload, err := readFrame(rw, frameAccept)
+	if err != nil {
+		return err
+	}
+	values, err := decodeUvarints(payload, 2)
+	if err != nil {
+		return sendError(rw, err)
+	}
+	a := accept{version: values[0], chunkSize: values[1]}
+	if a.version < MinProtocolVersion || a.version > ProtocolVersion {
+		return sendError(rw, ErrVersionMismatch)
+	}
+	if !chunkSizeAccepted(int(a.chunkSize), config) {
+		return sendError(rw, ErrChunkSizeMismatch)
+	}
+
+	signature, err := basisSignature(ctx, basis, int(a.chunkSize))
+	if err != nil {
+		return sendError(rw, err)
+	}
+	signatureWriter := frameWriter{w: rw, t: frameSignature}
+	if err := rolling.WriteSignature(signatureWriter, signature); err != nil {
+		return err
+	}
+	if err := signatureWriter.Close(); err != nil {
+		return err
+	}
+
+	deltaReader := &frameReader{r: rw, t: frameDelta}
+	delta, err := rolling.ReadDelta(deltaReader)
+	if err == nil {
+		err = deltaReader.drain()
+	}
+	if err != nil {
+		return sendError(rw, err)
+	}
+	if len(delta.Checksum) == 0 {
+		return sendError(rw, ErrMissingChecksum)
+	}
+
+	if _, err := basis.Seek(0, io.SeekStart); err != nil {
+		return sendError(rw, err)
+	}
+	if err := rolling.ApplyContext(ctx, out, basis, signature, delta); err != nil {
+		return sendError(rw, err)
+	}
+
+	return writeFrame(rw, frameDone, nil)
+}
+
+// Send sends data read from r to receiver as delta against receiver's basis.
+// Context cancels computations but not blocked reads and writes of rw, close rw to stop them.
+func Send(ctx context.Context, rw io.ReadWriter, r io.Reader, config Config) error {
+	payload, err := readFrame(rw, frameHello)
+	if err != nil {
+		return err
+	}
+	values, err := decodeUvarints(payload, 5)
+	if err != nil {
+		return sendError(rw, err)
+	}
+	h := hello{
+		minVersion:   values[0],
+		maxVersion:   values[1],
+		chunkSize:    values[2],
+		minChunkSize: values[3],
+		maxChunkSize: values[4],
+	}
+
+	a, err := negotiate(h, config)
+	if err != nil {
+		return sendError(rw, err)
+	}
+	if err := writeFrame(rw, frameAccept, encodeUvarints(a.version, a.chunkSize)); err != nil {
+		return err
+	}
+
+	signatureReader := &frameReader{r: rw, t: frameSignature}
+	signature, err := rolling.ReadSignature(signatureReader)
+	if err == nil {
+		err = signatureReader.drain()
+	}
+	if err != nil {
+		return sendError(rw, err)
+	}
+	if signature.ChunkSize != int(a.chunkSize) {
+		return sendError(rw, ErrChunkSizeMismatch)
+	}
+
+	delta, err := rolling.DeltaFromReaderContext(ctx, r, signature)
+	if err != nil {
+		return sendError(rw, err)
+	}
+	deltaWriter := frameWriter{w: rw, t: frameDelta}
+	if err := rolling.WriteDelta(deltaWriter, delta); err != nil {
+		return err
+	}
+	if err := deltaWriter.Close(); err != nil {
+		return err
+	}
+
+	_, err = readFrame(rw, frameDone)
+	return err
+}
+
+// returns protocol version and chunk size accepted by both sides
+func negotiate(h hello, config Config) (accept, error) {
+	version := h.maxVersion
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	if version < h.minVersion || version < MinProtocolVersion {
+		return accept{}, ErrVersionMismatch
+	}
+
+	minChunkSize := maxLimit(int(h.minChunkSize), config.MinChunkSize)
+	maxChunkSize := minLimit(int(h.maxChunkSize), config.maxChunkSize())
+	if maxChunkSize > 0 && minChunkSize > maxChunkSize {
+		return accept{}, ErrChunkSizeMismatch
+	}
+	chunkSize := int(h.chunkSize)
+	if chunkSize < minChunkSize {
+		chunkSize = minChunkSize
+	}
+	if maxChunkSize > 0 && chunkSize > maxChunkSize {
+		chunkSize = maxChunkSize
+	}
+	if chunkSize <= 0 {
+		return accept{}, ErrChunkSizeMismatch
+	}
+
+	return accept{
+		version:   version,
+		chunkSize: uint64(chunkSize),
+	}, nil
+}
+
+func chunkSizeAccepted(chunkSize int, config Config) bool {
+	if chunkSize <= 0 || chunkSize < config.MinChunkSize {
+		return false
+	}
+	return chunkSize <= config.maxChunkSize()
+}
+
+// returns signature of basis, basis too small for signature is treated as empty
+func basisSignature(ctx context.Context, basis io.ReadSeeker, chunkSize int) (rolling.Signature, error) {
+	if _, err := basis.Seek(0, io.SeekStart); err != nil {
+		return rolling.Signature{}, err
+	}
+	return rolling.SignatureFromReaderContext(ctx, basis, chunkSize, rolling.WithSmallInput())
+}
+
+// sends err to peer as error frame and returns it, errors reported by the peer are not sent back
+func sendError(w io.Writer, err error) error {
+	if _, ok := err.(*RemoteError); !ok {
+		_ = writeFrame(w, frameError, []byte(err.Error()))
+	}
+	return err
+}
+
+func encodeUvarints(values ...uint64) []byte {
+	buf := &bytes.Buffer{}
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, v := range values {
+		n := binary.PutUvarint(tmp, v)
+		buf.Write(tmp[:n])
+	}
+	return buf.Bytes()
+}
+
+func decodeUvarints(payload []byte, count int) ([]uint64, error) {
+	r := bytes.NewReader(payload)
+	values := make([]uint64, count)
+	for i := range values {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame payload: %w", err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// returns greater of limits, zero means no limit
+func maxLimit(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// returns smaller of limits, zero means no limit
+func minLimit(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
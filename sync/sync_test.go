@@ -0,0 +1,213 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+func TestSendReceive(t *testing.T) {
+	cases := map[string]struct {
+		givenBasis          []byte
+		givenUpdated        []byte
+		givenReceiverConfig Config
+		givenSenderConfig   Config
+	}{
+		"small chunks": {
+			givenBasis:          []byte("AAAABBBBCCCCDDDDEE"),
+			givenUpdated:        []byte("AAAAXXXXCCCCDDDDEEZZ"),
+			givenReceiverConfig: Config{ChunkSize: 4},
+		},
+		"default chunk size, large data": {
+			givenBasis:   bytes.Repeat([]byte("0123456789"), 100000),
+			givenUpdated: append(bytes.Repeat([]byte("0123456789"), 90000), bytes.Repeat([]byte("abc"), 5000)...),
+		},
+		"chunk size raised to sender minimum": {
+			givenBasis:          []byte("AAAABBBBCCCCDDDDEE"),
+			givenUpdated:        []byte("AAAABBBBXXXX"),
+			givenReceiverConfig: Config{ChunkSize: 2},
+			givenSenderConfig:   Config{MinChunkSize: 8},
+		},
+		"empty basis": {
+			givenBasis:          []byte{},
+			givenUpdated:        []byte("AAAABBBB"),
+			givenReceiverConfig: Config{ChunkSize: 4},
+		},
+		"empty updated": {
+			givenBasis:          []byte("AAAABBBB"),
+			givenUpdated:        []byte{},
+			givenReceiverConfig: Config{ChunkSize: 4},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			receiverConn, senderConn := net.Pipe()
+			defer receiverConn.Close()
+			defer senderConn.Close()
+
+			sendErr := make(chan error, 1)
+			go func() {
+				sendErr <- Send(context.Background(), senderConn, bytes.NewReader(c.givenUpdated), c.givenSenderConfig)
+			}()
+
+			out := &bytes.Buffer{}
+			err := Receive(context.Background(), receiverConn, bytes.NewReader(c.givenBasis), out, c.givenReceiverConfig)
+
+			assert.NoError(t, err)
+			assert.NoError(t, <-sendErr)
+			assert.Equal(t, string(c.givenUpdated), out.String())
+		})
+	}
+}
+
+func TestSendReceive_Err(t *testing.T) {
+	cases := map[string]struct {
+		givenBasis          io.ReadSeeker
+		givenReceiverConfig Config
+		givenSenderConfig   Config
+		expectedSendErr     error
+		expectedReceiveErr  error
+	}{
+		"err no common chunk size": {
+			givenBasis:          bytes.NewReader([]byte("AAAABBBB")),
+			givenReceiverConfig: Config{ChunkSize: 4, MaxChunkSize: 4},
+			givenSenderConfig:   Config{MinChunkSize: 8},
+			expectedSendErr:     ErrChunkSizeMismatch,
+			expectedReceiveErr:  &RemoteError{Message: ErrChunkSizeMismatch.Error()},
+		},
+		"err basis changed before apply": {
+			givenBasis:          &changingReadSeeker{data: [][]byte{[]byte("AAAABBBBCCCC"), []byte("AAAAXXXXCCCC")}},
+			givenReceiverConfig: Config{ChunkSize: 4},
+			expectedSendErr:     &RemoteError{Message: rolling.ErrApplyChecksumMismatch.Error()},
+			expectedReceiveErr:  rolling.ErrApplyChecksumMismatch,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			receiverConn, senderConn := net.Pipe()
+			defer receiverConn.Close()
+			defer senderConn.Close()
+
+			sendErr := make(chan error, 1)
+			go func() {
+				sendErr <- Send(context.Background(), senderConn, bytes.NewReader([]byte("AAAABBBBCCCCDD")), c.givenSenderConfig)
+			}()
+
+			err := Receive(context.Background(), receiverConn, c.givenBasis, &bytes.Buffer{}, c.givenReceiverConfig)
+
+			assert.Equal(t, c.expectedReceiveErr, err)
+			assert.Equal(t, c.expectedSendErr, <-sendErr)
+		})
+	}
+}
+
+func TestSend_ErrVersionMismatch(t *testing.T) {
+	receiverConn, senderConn := net.Pipe()
+	defer receiverConn.Close()
+	defer senderConn.Close()
+
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- Send(context.Background(), senderConn, bytes.NewReader([]byte("AAAA")), Config{})
+	}()
+
+	// receiver supporting only newer protocol versions
+	assert.NoError(t, writeFrame(receiverConn, frameHello, encodeUvarints(ProtocolVersion+1, ProtocolVersion+2, 4, 0, 0)))
+	_, err := readFrame(receiverConn, frameAccept)
+
+	assert.Equal(t, &RemoteError{Message: ErrVersionMismatch.Error()}, err)
+	assert.Equal(t, ErrVersionMismatch, <-sendErr)
+}
+
+func TestSend_ChunkSizeLimit(t *testing.T) {
+	cases := map[string]struct {
+		givenSenderConfig Config
+		givenHello        []uint64
+		expectedChunkSize uint64
+		expectedErr       error
+	}{
+		"proposed chunk size limited by default": {
+			givenHello:        []uint64{MinProtocolVersion, ProtocolVersion, 1 << 40, 0, 0},
+			expectedChunkSize: rolling.MaxChunkSize,
+		},
+		"proposed chunk size limited by config": {
+			givenSenderConfig: Config{MaxChunkSize: 1024},
+			givenHello:        []uint64{MinProtocolVersion, ProtocolVersion, 1 << 40, 0, 0},
+			expectedChunkSize: 1024,
+		},
+		"err minimal chunk size above default limit": {
+			givenHello:  []uint64{MinProtocolVersion, ProtocolVersion, 1 << 40, 1 << 40, 0},
+			expectedErr: ErrChunkSizeMismatch,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			receiverConn, senderConn := net.Pipe()
+			defer receiverConn.Close()
+			defer senderConn.Close()
+
+			sendErr := make(chan error, 1)
+			go func() {
+				sendErr <- Send(context.Background(), senderConn, bytes.NewReader([]byte("AAAA")), c.givenSenderConfig)
+			}()
+
+			assert.NoError(t, writeFrame(receiverConn, frameHello, encodeUvarints(c.givenHello...)))
+			payload, err := readFrame(receiverConn, frameAccept)
+			if c.expectedErr != nil {
+				assert.Equal(t, &RemoteError{Message: c.expectedErr.Error()}, err)
+				assert.Equal(t, c.expectedErr, <-sendErr)
+				return
+			}
+			assert.NoError(t, err)
+			values, err := decodeUvarints(payload, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedChunkSize, values[1])
+			receiverConn.Close()
+			<-sendErr
+		})
+	}
+}
+
+func TestReceive_ErrChunkSizeAboveDefaultLimit(t *testing.T) {
+	receiverConn, senderConn := net.Pipe()
+	defer receiverConn.Close()
+	defer senderConn.Close()
+
+	receiveErr := make(chan error, 1)
+	go func() {
+		receiveErr <- Receive(context.Background(), receiverConn, bytes.NewReader([]byte("AAAA")), &bytes.Buffer{}, Config{})
+	}()
+
+	// sender accepting chunk size the receiver never proposed
+	_, err := readFrame(senderConn, frameHello)
+	assert.NoError(t, err)
+	assert.NoError(t, writeFrame(senderConn, frameAccept, encodeUvarints(ProtocolVersion, 1<<40)))
+	_, err = readFrame(senderConn, frameSignature)
+
+	assert.Equal(t, &RemoteError{Message: ErrChunkSizeMismatch.Error()}, err)
+	assert.Equal(t, ErrChunkSizeMismatch, <-receiveErr)
+}
+
+// changingReadSeeker returns next data after every seek to start
+type changingReadSeeker struct {
+	data    [][]byte
+	current *bytes.Reader
+	seeks   int
+}
+
+func (c *changingReadSeeker) Read(p []byte) (int, error) {
+	return c.current.Read(p)
+}
+
+func (c *changingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	c.current = bytes.NewReader(c.data[mathx.Min(c.seeks, len(c.data)-1)])
+	c.seeks++
+	return c.current.Seek(offset, whence)
+}
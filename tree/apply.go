@@ -0,0 +1,341 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+)
+
+var (
+	ErrInvalidChangeset    = errors.New("changeset doesn't match manifest")
+	ErrAmbiguousRootBackup = errors.New("root is missing and more than one backup of it was left by interrupted apply")
+)
+
+// suffix of directory keeping the previous tree while root is replaced
+const backupSuffix = ".old"
+
+// Apply applies changeset to tree with given root described by manifest, tree mustn't be modified after
+// manifest was built. New tree is built in temporary directory next to root, unchanged files are hard linked
+// if possible. Root is replaced with new tree only if all changes are applied, otherwise it's left untouched.
+//
+// Replacement isn't atomic, it takes two renames: root is moved to backup directory .{root}.sync-*.old next to it
+// and new tree is moved in its place. If process is interrupted between them root doesn't exist and the previous
+// tree is kept in backup directory, it can be renamed back manually and the next Apply restores it itself.
+// Backup left by apply interrupted after both renames and staging directories left by interrupted build
+// are removed by the next Apply, so Apply mustn't be called concurrently for the same root.
+func Apply(ctx context.Context, root string, manifest Manifest, changeset Changeset, opts ...Option) error {
+	root = filepath.Clean(root)
+	if err := recoverRoot(root); err != nil {
+		return err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	targets, err := targetEntries(manifest, changeset)
+	if err != nil {
+		return err
+	}
+
+	staging, err := ioutil.TempDir(filepath.Dir(root), stagingPrefix(root))
+	if err != nil {
+		return err
+	}
+	if err := build(ctx, root, staging, manifest, targets, newOptions(opts)); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	if err := os.Chmod(staging, info.Mode().Perm()); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	return replaceDir(root, staging)
+}
+
+// target is entry of new tree with change creating it, unchanged entries have no change
+type target struct {
+	path   string
+	change *Change
+}
+
+// returns entries of new tree ordered by path, so directories precede their content
+func targetEntries(manifest Manifest, changeset Changeset) ([]target, error) {
+	origin := manifest.index()
+	targets := make(map[string]target, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		targets[entry.Path] = target{path: entry.Path}
+	}
+
+	for i := range changeset.Changes {
+		change := &changeset.Changes[i]
+		if !validPath(change.Path) {
+			return nil, ErrInvalidChangeset
+		}
+		if change.Basis != "" {
+			basis, ok := origin[change.Basis]
+			if !ok || basis.Type != EntryTypeFile {
+				return nil, ErrInvalidChangeset
+			}
+		}
+
+		switch change.Type {
+		case ChangeTypeDelete:
+			if _, ok := origin[change.Path]; !ok {
+				return nil, ErrInvalidChangeset
+			}
+			for path := range targets {
+				if path == change.Path || strings.HasPrefix(path, change.Path+"/") {
+					delete(targets, path)
+				}
+			}
+		case ChangeTypeCreate, ChangeTypeRename:
+			if _, ok := targets[change.Path]; ok {
+				return nil, ErrInvalidChangeset
+			}
+			if change.Type == ChangeTypeRename {
+				if change.Basis == "" {
+					return nil, ErrInvalidChangeset
+				}
+				delete(targets, change.Basis)
+			}
+			targets[change.Path] = target{path: change.Path, change: change}
+		case ChangeTypeUpdate, ChangeTypeMetadata:
+			old, ok := origin[change.Path]
+			if _, exists := targets[change.Path]; !ok || !exists || old.Type != change.Metadata.Type {
+				return nil, ErrInvalidChangeset
+			}
+			targets[change.Path] = target{path: change.Path, change: change}
+		default:
+			return nil, ErrInvalidChangeset
+		}
+	}
+
+	sorted := make([]target, 0, len(targets))
+	for _, t := range targets {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].path < sorted[j].path
+	})
+	for _, t := range sorted {
+		// parent of every entry has to be directory of new tree
+		if parent := parentPath(t.path); parent != "" {
+			if p, ok := targets[parent]; !ok || p.metadata(origin).Type != EntryTypeDir {
+				return nil, ErrInvalidChangeset
+			}
+		}
+		// hard link has to be linked to preceding file which isn't hard link
+		if hardlink := t.metadata(origin).Hardlink; hardlink != "" {
+			linked, ok := targets[hardlink]
+			if !ok || hardlink >= t.path || linked.metadata(origin).Type != EntryTypeFile || linked.metadata(origin).Hardlink != "" {
+				return nil, ErrInvalidChangeset
+			}
+		}
+	}
+	return sorted, nil
+}
+
+// builds new tree in staging directory, metadata of directories is set after their content is written
+func build(ctx context.Context, root, staging string, manifest Manifest, targets []target, o options) error {
+	origin := manifest.index()
+	dirs := make([]target, 0)
+	for _, t := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		src := filepath.Join(root, filepath.FromSlash(t.path))
+		dst := filepath.Join(staging, filepath.FromSlash(t.path))
+		metadata := t.metadata(origin)
+
+		var err error
+		switch {
+		case metadata.Type == EntryTypeDir:
+			err = os.Mkdir(dst, 0700)
+			dirs = append(dirs, t)
+		case metadata.Type == EntryTypeSymlink:
+			err = os.Symlink(filepath.FromSlash(metadata.LinkTarget), dst)
+			if err == nil {
+				err = setMetadata(dst, metadata, o)
+			}
+		case metadata.Hardlink != "":
+			err = os.Link(filepath.Join(staging, filepath.FromSlash(metadata.Hardlink)), dst)
+		case t.change == nil:
+			err = copyFile(src, dst, metadata, true, o)
+		case t.change.Type == ChangeTypeMetadata:
+			err = copyFile(src, dst, metadata, false, o)
+		default:
+			err = applyFile(ctx, root, dst, manifest.ChunkSize, origin, t.change)
+			if err == nil {
+				err = setMetadata(dst, metadata, o)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dst := filepath.Join(staging, filepath.FromSlash(dirs[i].path))
+		if err := setMetadata(dst, dirs[i].metadata(origin), o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copies file of old tree, it's hard linked if allowed
+func copyFile(src, dst string, metadata Metadata, link bool, o options) error {
+	if link && os.Link(src, dst) == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return setMetadata(dst, metadata, o)
+}
+
+// writes file reconstructed from basis and delta of change
+func applyFile(ctx context.Context, root, dst string, chunkSize int, origin map[string]Entry, change *Change) error {
+	signature := rolling.EmptySignature(chunkSize)
+	var basis io.Reader = strings.NewReader("")
+	if change.Basis != "" {
+		f, err := os.Open(filepath.Join(root, filepath.FromSlash(change.Basis)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		basis = f
+		signature = origin[change.Basis].Signature
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := rolling.ApplyContext(ctx, out, basis, signature, change.Delta); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// replaces root with staging directory by two renames, root doesn't exist between them and it's moved back
+// if the second rename fails
+func replaceDir(root, staging string) error {
+	backup := staging + backupSuffix
+	if err := os.Rename(root, backup); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	if err := os.Rename(staging, root); err != nil {
+		os.Rename(backup, root)
+		os.RemoveAll(staging)
+		return err
+	}
+	return os.RemoveAll(backup)
+}
+
+// restores root from backup left by apply interrupted between renames of replaceDir, backups left by apply
+// interrupted after both renames and staging directories left by interrupted apply are removed
+func recoverRoot(root string) error {
+	parent := filepath.Dir(root)
+	siblings, err := ioutil.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+	backups := make([]string, 0)
+	stagings := make([]string, 0)
+	for _, sibling := range siblings {
+		name := sibling.Name()
+		if !sibling.IsDir() || !strings.HasPrefix(name, stagingPrefix(root)) {
+			continue
+		}
+		if strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, filepath.Join(parent, name))
+		} else {
+			stagings = append(stagings, filepath.Join(parent, name))
+		}
+	}
+
+	if _, err := os.Lstat(root); os.IsNotExist(err) && len(backups) > 0 {
+		if len(backups) > 1 {
+			return ErrAmbiguousRootBackup
+		}
+		if err := os.Rename(backups[0], root); err != nil {
+			return err
+		}
+		backups = backups[:0]
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// new tree built by interrupted apply may be complete, but it's dropped to return to state known by sender
+	for _, dir := range append(backups, stagings...) {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns prefix of names of temporary directories created next to root
+func stagingPrefix(root string) string {
+	return "." + filepath.Base(root) + ".sync-"
+}
+
+// returns metadata of entry in new tree
+func (t target) metadata(origin map[string]Entry) Metadata {
+	if t.change != nil {
+		return t.change.Metadata
+	}
+	return origin[t.path].Metadata
+}
+
+func parentPath(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// reports whether path is slash separated relative path without . and .. elements
+func validPath(path string) bool {
+	if path == "" || strings.HasPrefix(path, "/") || strings.Contains(path, "\\") {
+		return false
+	}
+	for _, element := range strings.Split(path, "/") {
+		if element == "" || element == "." || element == ".." {
+			return false
+		}
+	}
+	return true
+}
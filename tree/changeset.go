@@ -0,0 +1,192 @@
+package tree
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+)
+
+type ChangeType int
+
+const (
+	// ChangeTypeCreate creates entry, content of created file is delta against basis or empty data
+	ChangeTypeCreate ChangeType = iota
+	// ChangeTypeUpdate replaces content of file with delta against its current content
+	ChangeTypeUpdate
+	// ChangeTypeDelete deletes entry, directory is deleted with its content
+	ChangeTypeDelete
+	// ChangeTypeRename moves basis file to path, content is delta against basis
+	ChangeTypeRename
+	// ChangeTypeMetadata changes only metadata of entry
+	ChangeTypeMetadata
+)
+
+// Change of single tree entry
+type Change struct {
+	Type ChangeType
+	Path string
+	// Metadata is new metadata of entry, it isn't set for deleted entries
+	Metadata
+	// Basis is path of file in receiver tree delta is calculated against, it's empty if delta contains whole content
+	Basis string
+	Delta rolling.Delta
+}
+
+// Changeset transforms tree described by manifest into sender tree, changes are ordered by path
+type Changeset struct {
+	Changes []Change
+}
+
+// Diff returns changeset transforming tree described by manifest into tree with given root.
+// Files not existing in manifest reuse content of similar manifest files, see WithSimilarityThreshold.
+func Diff(ctx context.Context, root string, manifest Manifest, opts ...Option) (Changeset, error) {
+	if manifest.ChunkSize <= 0 {
+		return Changeset{}, rolling.ErrCalculateSignatureInvalidChunkSize
+	}
+
+	o := newOptions(opts)
+	entries, err := readTree(root, o)
+	if err != nil {
+		return Changeset{}, err
+	}
+
+	origin := manifest.index()
+	current := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		current[entry.Path] = true
+	}
+	sources := newSources(manifest, current, o.similarityThreshold)
+
+	changes := make([]Change, 0)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return Changeset{}, err
+		}
+
+		path := filepath.Join(root, filepath.FromSlash(entry.Path))
+		old, exists := origin[entry.Path]
+		if exists && (old.Type != entry.Type || old.Hardlink != entry.Hardlink) {
+			changes = append(changes, Change{
+				Type: ChangeTypeDelete,
+				Path: entry.Path,
+			})
+			exists = false
+		}
+
+		switch {
+		case entry.Type != EntryTypeFile || entry.Hardlink != "":
+			// hard link shares content and metadata with file it's linked to
+			if !exists {
+				changes = append(changes, Change{
+					Type:     ChangeTypeCreate,
+					Path:     entry.Path,
+					Metadata: entry.Metadata,
+				})
+			} else if entry.Hardlink == "" && !sameMetadata(old.Metadata, entry.Metadata, o) {
+				changes = append(changes, Change{
+					Type:     ChangeTypeMetadata,
+					Path:     entry.Path,
+					Metadata: entry.Metadata,
+				})
+			}
+		case !exists:
+			change, err := newFileChange(ctx, path, entry, sources)
+			if err != nil {
+				return Changeset{}, err
+			}
+			changes = append(changes, change)
+		default:
+			delta, err := deltaOf(ctx, path, old.Signature)
+			if err != nil {
+				return Changeset{}, err
+			}
+			if !isUnchanged(delta, old, entry) {
+				changes = append(changes, Change{
+					Type:     ChangeTypeUpdate,
+					Path:     entry.Path,
+					Metadata: entry.Metadata,
+					Basis:    entry.Path,
+					Delta:    delta,
+				})
+			} else if !sameMetadata(old.Metadata, entry.Metadata, o) {
+				changes = append(changes, Change{
+					Type:     ChangeTypeMetadata,
+					Path:     entry.Path,
+					Metadata: entry.Metadata,
+				})
+			}
+		}
+	}
+
+	for _, entry := range manifest.Entries {
+		if current[entry.Path] || sources.renamed[entry.Path] {
+			continue
+		}
+		changes = append(changes, Change{
+			Type: ChangeTypeDelete,
+			Path: entry.Path,
+		})
+	}
+	sortChanges(changes)
+
+	return Changeset{
+		Changes: changes,
+	}, nil
+}
+
+// returns change of file not existing in manifest, content of the most similar manifest file is reused:
+// unused deleted file is renamed, other files are basis of created file
+func newFileChange(ctx context.Context, path string, entry Entry, sources *sources) (Change, error) {
+	signature, checksum, err := signatureOf(ctx, path, sources.chunkSize)
+	if err != nil {
+		return Change{}, err
+	}
+
+	change := Change{
+		Type:     ChangeTypeCreate,
+		Path:     entry.Path,
+		Metadata: entry.Metadata,
+	}
+	basis := rolling.EmptySignature(sources.chunkSize)
+	if source, rename, ok := sources.match(entry.Size, checksum, signature); ok {
+		if rename {
+			change.Type = ChangeTypeRename
+		}
+		change.Basis = source.Path
+		basis = source.Signature
+	}
+	change.Delta, err = deltaOf(ctx, path, basis)
+	if err != nil {
+		return Change{}, err
+	}
+	return change, nil
+}
+
+func deltaOf(ctx context.Context, path string, signature rolling.Signature) (rolling.Delta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return rolling.Delta{}, err
+	}
+	defer f.Close()
+
+	return rolling.DeltaFromReaderContext(ctx, f, signature)
+}
+
+// reports whether delta against old file produces the same content
+func isUnchanged(delta rolling.Delta, old, entry Entry) bool {
+	return old.Size == entry.Size && bytes.Equal(delta.Checksum, old.Checksum)
+}
+
+// sorts changes by path, deletion of entry is ordered before its creation
+func sortChanges(changes []Change) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Path != changes[j].Path {
+			return changes[i].Path < changes[j].Path
+		}
+		return changes[i].Type == ChangeTypeDelete && changes[j].Type != ChangeTypeDelete
+	})
+}
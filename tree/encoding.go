@@ -0,0 +1,349 @@
+package tree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+)
+
+// Encoded manifest and changeset start with header: magic and format version, it's followed by number of
+// records and records. Signatures and deltas in records are encoded with formats of rolling package.
+var (
+	manifestMagic  = []byte("RHTM")
+	changesetMagic = []byte("RHTC")
+)
+
+const (
+	formatVersion = 2
+
+	// limit of decoded path and checksum size protecting from allocation of huge buffers for corrupted input
+	maxFieldSize = 64 * 1024
+)
+
+var (
+	ErrDecodeInvalidFormat      = errors.New("invalid encoded manifest or changeset format")
+	ErrDecodeUnsupportedVersion = errors.New("unsupported encoded manifest or changeset version")
+)
+
+// WriteManifest writes encoded manifest to w
+func WriteManifest(w io.Writer, manifest Manifest) error {
+	e := newEncoder(w, manifestMagic)
+	e.uvarint(uint64(manifest.ChunkSize))
+	e.uvarint(uint64(len(manifest.Entries)))
+	for _, entry := range manifest.Entries {
+		e.string(entry.Path)
+		e.metadata(entry.Metadata)
+		if entry.Type != EntryTypeFile {
+			continue
+		}
+		e.uvarint(uint64(entry.Size))
+		if entry.Hardlink != "" {
+			continue
+		}
+		e.bytes(entry.Checksum)
+		e.signature(entry.Signature)
+	}
+	return e.flush()
+}
+
+// ReadManifest reads encoded manifest from r
+func ReadManifest(r io.Reader) (Manifest, error) {
+	d, err := newDecoder(r, manifestMagic)
+	if err != nil {
+		return Manifest{}, err
+	}
+	chunkSize := d.uvarint()
+	count := d.uvarint()
+	entries := make([]Entry, 0)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		entry := Entry{
+			Path:     d.string(),
+			Metadata: d.metadata(),
+		}
+		if entry.Type == EntryTypeFile {
+			entry.Size = int64(d.uvarint())
+		}
+		if entry.Type == EntryTypeFile && entry.Hardlink == "" {
+			entry.Checksum = d.bytes()
+			entry.Signature = d.signature()
+		}
+		entries = append(entries, entry)
+	}
+	if d.err != nil {
+		return Manifest{}, d.err
+	}
+	return Manifest{
+		ChunkSize: int(chunkSize),
+		Entries:   entries,
+	}, nil
+}
+
+// WriteChangeset writes encoded changeset to w
+func WriteChangeset(w io.Writer, changeset Changeset) error {
+	e := newEncoder(w, changesetMagic)
+	e.uvarint(uint64(len(changeset.Changes)))
+	for _, change := range changeset.Changes {
+		e.byte(byte(change.Type))
+		e.string(change.Path)
+		if change.Type == ChangeTypeDelete {
+			continue
+		}
+		e.metadata(change.Metadata)
+		if !hasDelta(change) {
+			continue
+		}
+		e.string(change.Basis)
+		e.delta(change.Delta)
+	}
+	return e.flush()
+}
+
+// ReadChangeset reads encoded changeset from r
+func ReadChangeset(r io.Reader) (Changeset, error) {
+	d, err := newDecoder(r, changesetMagic)
+	if err != nil {
+		return Changeset{}, err
+	}
+	count := d.uvarint()
+	changes := make([]Change, 0)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		change := Change{
+			Type: ChangeType(d.byte()),
+			Path: d.string(),
+		}
+		if change.Type == ChangeTypeDelete {
+			changes = append(changes, change)
+			continue
+		}
+		change.Metadata = d.metadata()
+		if hasDelta(change) {
+			change.Basis = d.string()
+			change.Delta = d.delta()
+		}
+		changes = append(changes, change)
+	}
+	if d.err != nil {
+		return Changeset{}, d.err
+	}
+	return Changeset{
+		Changes: changes,
+	}, nil
+}
+
+// reports whether change contains basis and delta
+func hasDelta(change Change) bool {
+	return change.Type != ChangeTypeDelete && change.Type != ChangeTypeMetadata &&
+		change.Metadata.Type == EntryTypeFile && change.Metadata.Hardlink == ""
+}
+
+// encoder writes fields to buffered w, the first error stops writing and is returned by flush
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newEncoder(w io.Writer, magic []byte) *encoder {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.write(magic)
+	e.byte(formatVersion)
+	return e
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+func (e *encoder) byte(b byte) {
+	e.write([]byte{b})
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (e *encoder) varint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func (e *encoder) bytes(p []byte) {
+	e.uvarint(uint64(len(p)))
+	e.write(p)
+}
+
+func (e *encoder) string(s string) {
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) metadata(metadata Metadata) {
+	e.byte(byte(metadata.Type))
+	e.uvarint(uint64(metadata.Mode))
+	modTime := int64(0)
+	if !metadata.ModTime.IsZero() {
+		modTime = metadata.ModTime.UnixNano()
+	}
+	e.varint(modTime)
+	e.string(metadata.LinkTarget)
+	e.string(metadata.Hardlink)
+	e.uvarint(uint64(metadata.UID))
+	e.uvarint(uint64(metadata.GID))
+
+	// extended attributes are written in name order, so encoding is deterministic
+	names := make([]string, 0, len(metadata.Xattrs))
+	for name := range metadata.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.uvarint(uint64(len(names)))
+	for _, name := range names {
+		e.string(name)
+		e.bytes(metadata.Xattrs[name])
+	}
+}
+
+func (e *encoder) signature(signature rolling.Signature) {
+	if e.err == nil {
+		e.err = rolling.WriteSignature(e.w, signature)
+	}
+}
+
+func (e *encoder) delta(delta rolling.Delta) {
+	if e.err == nil {
+		e.err = rolling.WriteDelta(e.w, delta)
+	}
+}
+
+func (e *encoder) flush() error {
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// decoder reads fields from r, the first error stops reading and is kept in err
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func newDecoder(r io.Reader, magic []byte) (*decoder, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return nil, decodeErr(err)
+	}
+	if string(header[:len(magic)]) != string(magic) {
+		return nil, ErrDecodeInvalidFormat
+	}
+	if header[len(magic)] != formatVersion {
+		return nil, ErrDecodeUnsupportedVersion
+	}
+	return d, nil
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.err = decodeErr(err)
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	d.err = decodeErr(err)
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.err = decodeErr(err)
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > maxFieldSize {
+		d.err = ErrDecodeInvalidFormat
+		return nil
+	}
+	p := make([]byte, n)
+	_, err := io.ReadFull(d.r, p)
+	d.err = decodeErr(err)
+	return p
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) metadata() Metadata {
+	metadata := Metadata{
+		Type:       EntryType(d.byte()),
+		Mode:       os.FileMode(d.uvarint()),
+		ModTime:    time.Unix(0, d.varint()),
+		LinkTarget: d.string(),
+		Hardlink:   d.string(),
+		UID:        int(d.uvarint()),
+		GID:        int(d.uvarint()),
+	}
+	if metadata.Type == EntryTypeSymlink {
+		// symbolic links have no time
+		metadata.ModTime = time.Time{}
+	}
+
+	count := d.uvarint()
+	if count > 0 {
+		metadata.Xattrs = make(map[string][]byte)
+	}
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		name := d.string()
+		metadata.Xattrs[name] = d.bytes()
+	}
+	return metadata
+}
+
+func (d *decoder) signature() rolling.Signature {
+	if d.err != nil {
+		return rolling.Signature{}
+	}
+	signature, err := rolling.ReadSignature(d.r)
+	d.err = err
+	return signature
+}
+
+func (d *decoder) delta() rolling.Delta {
+	if d.err != nil {
+		return rolling.Delta{}
+	}
+	delta, err := rolling.ReadDelta(d.r)
+	d.err = err
+	return delta
+}
+
+// returns ErrDecodeInvalidFormat if err is caused by unexpected end of data
+func decodeErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrDecodeInvalidFormat
+	}
+	return err
+}
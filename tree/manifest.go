@@ -0,0 +1,153 @@
+// Package tree synchronizes directory trees using per-file signatures and deltas.
+//
+// Receiver builds manifest of its tree with signatures of files and sends it to sender.
+// Sender compares its tree with manifest and produces changeset: deltas of created and updated files,
+// deleted and renamed entries and metadata changes. Receiver builds new tree next to its tree and replaces
+// its tree with it only if whole changeset is applied, see Apply for recovery of interrupted replacement.
+//
+// Regular files, directories, symbolic links and hard links are synchronized with their metadata,
+// other entries like devices or sockets are skipped. Owner and extended attributes are synchronized optionally.
+package tree
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+)
+
+// Entry of manifest describes file, directory or symbolic link of tree
+type Entry struct {
+	// Path is slash separated path relative to tree root
+	Path string
+	Metadata
+	Size int64
+	// Signature of file content, it isn't set for hard links, files too small for signature have signature without chunks
+	Signature rolling.Signature
+	// Checksum is sha256 of file content, it's the same as checksum of delta producing the file
+	Checksum []byte
+}
+
+// Manifest describes tree, entries are ordered by path
+type Manifest struct {
+	ChunkSize int
+	Entries   []Entry
+}
+
+// BuildManifest returns manifest of tree with given root, file signatures are calculated with chunk size
+func BuildManifest(ctx context.Context, root string, chunkSize int, opts ...Option) (Manifest, error) {
+	if chunkSize <= 0 {
+		return Manifest{}, rolling.ErrCalculateSignatureInvalidChunkSize
+	}
+
+	entries, err := readTree(root, newOptions(opts))
+	if err != nil {
+		return Manifest{}, err
+	}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Type != EntryTypeFile || entry.Hardlink != "" {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(entry.Path))
+		entry.Signature, entry.Checksum, err = signatureOf(ctx, path, chunkSize)
+		if err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	return Manifest{
+		ChunkSize: chunkSize,
+		Entries:   entries,
+	}, nil
+}
+
+// returns entries of tree ordered by path without signatures, root itself isn't included
+func readTree(root string, o options) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	ids := make(map[string]fileID)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		metadata, ok, err := readMetadata(path, info, o)
+		if err != nil || !ok {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entry := Entry{
+			Path:     rel,
+			Metadata: metadata,
+		}
+		if metadata.Type == EntryTypeFile {
+			entry.Size = info.Size()
+			if id, ok := hardlinkID(info); ok {
+				ids[rel] = id
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortEntries(entries)
+
+	// files sharing inode are hard links to the first of them
+	first := make(map[fileID]string)
+	for i := range entries {
+		id, ok := ids[entries[i].Path]
+		if !ok {
+			continue
+		}
+		if path, ok := first[id]; ok {
+			entries[i].Hardlink = path
+			continue
+		}
+		first[id] = entries[i].Path
+	}
+	return entries, nil
+}
+
+// returns signature and checksum of file, file too small for signature has signature without chunks
+func signatureOf(ctx context.Context, path string, chunkSize int) (rolling.Signature, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return rolling.Signature{}, nil, err
+	}
+	defer f.Close()
+
+	checksum := sha256.New()
+	signature, err := rolling.SignatureFromReaderContext(ctx, io.TeeReader(f, checksum), chunkSize, rolling.WithSmallInput())
+	if err != nil {
+		return rolling.Signature{}, nil, err
+	}
+	return signature, checksum.Sum(nil), nil
+}
+
+// returns entries indexed by path
+func (m Manifest) index() map[string]Entry {
+	index := make(map[string]Entry, len(m.Entries))
+	for _, entry := range m.Entries {
+		index[entry.Path] = entry
+	}
+	return index
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+}
@@ -0,0 +1,124 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type EntryType int
+
+const (
+	EntryTypeFile EntryType = iota
+	EntryTypeDir
+	EntryTypeSymlink
+)
+
+// modeBits are bits of file mode which are synchronized
+const modeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// Metadata describes entry apart from its content
+type Metadata struct {
+	Type EntryType
+	// Mode contains permission, setuid, setgid and sticky bits, it isn't set for symbolic links
+	Mode os.FileMode
+	// ModTime isn't set for symbolic links
+	ModTime time.Time
+	// LinkTarget is target of symbolic link
+	LinkTarget string
+	// Hardlink is path of file sharing content and metadata with this file, it precedes this file in path order
+	Hardlink string
+	// UID and GID are owner of entry, they're read on platforms supporting them and used only WithOwnership
+	UID int
+	GID int
+	// Xattrs are extended attributes of files and directories, they're read and restored only WithXattrs
+	Xattrs map[string][]byte
+}
+
+// returns metadata of entry, entries which aren't synchronized aren't ok
+func readMetadata(path string, info os.FileInfo, o options) (Metadata, bool, error) {
+	metadata := Metadata{
+		Mode:    info.Mode() & modeBits,
+		ModTime: info.ModTime(),
+	}
+	metadata.UID, metadata.GID = fileOwner(info)
+
+	switch {
+	case info.Mode().IsRegular():
+		metadata.Type = EntryTypeFile
+	case info.IsDir():
+		metadata.Type = EntryTypeDir
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return Metadata{}, false, err
+		}
+		return Metadata{
+			Type:       EntryTypeSymlink,
+			LinkTarget: filepath.ToSlash(target),
+			UID:        metadata.UID,
+			GID:        metadata.GID,
+		}, true, nil
+	default:
+		return Metadata{}, false, nil
+	}
+
+	if o.xattrs {
+		xattrs, err := readXattrs(path)
+		if err != nil {
+			return Metadata{}, false, err
+		}
+		metadata.Xattrs = xattrs
+	}
+	return metadata, true, nil
+}
+
+// sets metadata of created entry, content of directory has to be written before
+func setMetadata(path string, metadata Metadata, o options) error {
+	if o.ownership {
+		if err := os.Lchown(path, metadata.UID, metadata.GID); err != nil {
+			return err
+		}
+	}
+	if metadata.Type == EntryTypeSymlink {
+		return nil
+	}
+	// mode is set after owner, because changing owner clears setuid and setgid bits
+	if err := os.Chmod(path, metadata.Mode); err != nil {
+		return err
+	}
+	if o.xattrs {
+		if err := writeXattrs(path, metadata.Xattrs); err != nil {
+			return err
+		}
+	}
+	return os.Chtimes(path, metadata.ModTime, metadata.ModTime)
+}
+
+// reports whether metadata are equal, owner and extended attributes are compared only if they're synchronized
+func sameMetadata(a, b Metadata, o options) bool {
+	if a.Type != b.Type || a.Mode != b.Mode || !a.ModTime.Equal(b.ModTime) ||
+		a.LinkTarget != b.LinkTarget || a.Hardlink != b.Hardlink {
+		return false
+	}
+	if o.ownership && (a.UID != b.UID || a.GID != b.GID) {
+		return false
+	}
+	if o.xattrs && !sameXattrs(a.Xattrs, b.Xattrs) {
+		return false
+	}
+	return true
+}
+
+func sameXattrs(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		other, ok := b[name]
+		if !ok || string(value) != string(other) {
+			return false
+		}
+	}
+	return true
+}
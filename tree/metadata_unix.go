@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package tree
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies inode of file
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// returns id of file if it has more than one hard link
+func hardlinkID(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
+
+func fileOwner(info os.FileInfo) (int, int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return int(stat.Uid), int(stat.Gid)
+}
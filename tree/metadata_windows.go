@@ -0,0 +1,14 @@
+package tree
+
+import "os"
+
+// fileID identifies inode of file, hard links aren't detected on windows
+type fileID struct{}
+
+func hardlinkID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+func fileOwner(info os.FileInfo) (int, int) {
+	return 0, 0
+}
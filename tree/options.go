@@ -0,0 +1,46 @@
+package tree
+
+// DefaultSimilarityThreshold is minimal share of new file chunks found in manifest file to reuse its content
+const DefaultSimilarityThreshold = 0.5
+
+// Option configures optional behaviour of BuildManifest, Diff and Apply, receiver and sender have to use the same
+// metadata options
+type Option func(*options)
+
+type options struct {
+	similarityThreshold float64
+	ownership           bool
+	xattrs              bool
+}
+
+// WithSimilarityThreshold sets minimal share of new file chunks, from 0 to 1, which has to be found in manifest file
+// to calculate delta of new file against it, threshold greater than 1 disables similarity matching
+func WithSimilarityThreshold(threshold float64) Option {
+	return func(o *options) {
+		o.similarityThreshold = threshold
+	}
+}
+
+// WithOwnership synchronizes owner and group of entries, applying changeset usually requires superuser privileges
+func WithOwnership() Option {
+	return func(o *options) {
+		o.ownership = true
+	}
+}
+
+// WithXattrs synchronizes extended attributes of files and directories, it's supported only on linux
+func WithXattrs() Option {
+	return func(o *options) {
+		o.xattrs = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		similarityThreshold: DefaultSimilarityThreshold,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
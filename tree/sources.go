@@ -0,0 +1,112 @@
+package tree
+
+import (
+	"strconv"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+)
+
+// sources are manifest files whose content can be reused by new files of sender tree
+type sources struct {
+	chunkSize int
+	threshold float64
+	files     []Entry
+	// indexes of files containing chunk hash, each file is listed once per hash
+	byChunk map[string][]int
+	// indexes of deleted files by size and checksum
+	byContent map[string][]int
+	deleted   map[string]bool
+	// deleted files already used as rename source
+	renamed map[string]bool
+}
+
+func newSources(manifest Manifest, current map[string]bool, threshold float64) *sources {
+	s := &sources{
+		chunkSize: manifest.ChunkSize,
+		threshold: threshold,
+		byChunk:   make(map[string][]int),
+		byContent: make(map[string][]int),
+		deleted:   make(map[string]bool),
+		renamed:   make(map[string]bool),
+	}
+	for _, entry := range manifest.Entries {
+		// empty files have nothing worth reusing, hard links are reused through files they're linked to
+		if entry.Type != EntryTypeFile || entry.Size == 0 || entry.Hardlink != "" {
+			continue
+		}
+		i := len(s.files)
+		s.files = append(s.files, entry)
+		if !current[entry.Path] {
+			s.deleted[entry.Path] = true
+			key := contentKey(entry.Size, entry.Checksum)
+			s.byContent[key] = append(s.byContent[key], i)
+		}
+
+		seen := make(map[string]bool, len(entry.Signature.ChunksHashes))
+		for _, hash := range entry.Signature.ChunksHashes {
+			if seen[string(hash)] {
+				continue
+			}
+			seen[string(hash)] = true
+			s.byChunk[string(hash)] = append(s.byChunk[string(hash)], i)
+		}
+	}
+	return s
+}
+
+// returns source file for new file and whether it's renamed. Unused deleted file with the same content
+// is preferred, otherwise file sharing the biggest part of new file chunks is returned if the part
+// reaches similarity threshold, deleted files win ties.
+func (s *sources) match(size int64, checksum []byte, signature rolling.Signature) (Entry, bool, bool) {
+	for _, i := range s.byContent[contentKey(size, checksum)] {
+		if !s.renamed[s.files[i].Path] {
+			s.renamed[s.files[i].Path] = true
+			return s.files[i], true, true
+		}
+	}
+
+	chunksCount := len(signature.ChunksHashes)
+	if chunksCount == 0 || s.threshold > 1 {
+		return Entry{}, false, false
+	}
+	common := make(map[int]int)
+	for _, hash := range signature.ChunksHashes {
+		for _, i := range s.byChunk[string(hash)] {
+			common[i]++
+		}
+	}
+
+	best := -1
+	for i, count := range common {
+		if best < 0 || s.better(i, count, best, common[best]) {
+			best = i
+		}
+	}
+	if best < 0 || float64(common[best])/float64(chunksCount) < s.threshold {
+		return Entry{}, false, false
+	}
+
+	source := s.files[best]
+	rename := s.deleted[source.Path] && !s.renamed[source.Path]
+	if rename {
+		s.renamed[source.Path] = true
+	}
+	return source, rename, true
+}
+
+// reports whether file i with count common chunks is better source than file j
+func (s *sources) better(i, countI, j, countJ int) bool {
+	if countI != countJ {
+		return countI > countJ
+	}
+	renameI := s.deleted[s.files[i].Path] && !s.renamed[s.files[i].Path]
+	renameJ := s.deleted[s.files[j].Path] && !s.renamed[s.files[j].Path]
+	if renameI != renameJ {
+		return renameI
+	}
+	return s.files[i].Path < s.files[j].Path
+}
+
+func contentKey(size int64, checksum []byte) string {
+	return strconv.FormatInt(size, 10) + ":" + string(checksum)
+}
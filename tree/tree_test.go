@@ -0,0 +1,642 @@
+package tree
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/stretchr/testify/assert"
+)
+
+var testModTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// testEntry describes entry of test tree, entry without data and links is directory
+type testEntry struct {
+	data     []byte
+	mode     os.FileMode
+	link     string
+	hardlink string
+}
+
+func writeTree(t *testing.T, root string, entries map[string]testEntry) {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		entry := entries[path]
+		full := filepath.Join(root, filepath.FromSlash(path))
+		switch {
+		case entry.link != "":
+			assert.NoError(t, os.Symlink(entry.link, full))
+		case entry.hardlink != "":
+			assert.NoError(t, os.Link(filepath.Join(root, entry.hardlink), full))
+		case entry.data == nil:
+			assert.NoError(t, os.Mkdir(full, 0755))
+		default:
+			assert.NoError(t, ioutil.WriteFile(full, entry.data, 0644))
+		}
+	}
+	// modes and times are set after all entries are written, so directories are still writable
+	for i := len(paths) - 1; i >= 0; i-- {
+		if entries[paths[i]].link != "" || entries[paths[i]].hardlink != "" {
+			continue
+		}
+		full := filepath.Join(root, filepath.FromSlash(paths[i]))
+		assert.NoError(t, os.Chmod(full, entries[paths[i]].mode))
+		assert.NoError(t, os.Chtimes(full, testModTime, testModTime))
+	}
+}
+
+func readTestTree(t *testing.T, root string) map[string]testEntry {
+	treeEntries, err := readTree(root, options{})
+	assert.NoError(t, err)
+
+	entries := make(map[string]testEntry)
+	for _, e := range treeEntries {
+		entry := testEntry{
+			mode:     e.Mode,
+			link:     e.LinkTarget,
+			hardlink: e.Hardlink,
+		}
+		if e.Type == EntryTypeFile {
+			entry.data, err = ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(e.Path)))
+			assert.NoError(t, err)
+		}
+		if e.Type != EntryTypeSymlink {
+			assert.True(t, testModTime.Equal(e.ModTime), e.Path)
+		}
+		entries[e.Path] = entry
+	}
+	return entries
+}
+
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestSync(t *testing.T) {
+	large := randomData(1, 10000)
+	updated := append([]byte{}, large...)
+	copy(updated[5000:], "changed")
+
+	cases := map[string]struct {
+		givenReceiver       map[string]testEntry
+		givenSender         map[string]testEntry
+		expectedChangeTypes map[string]ChangeType
+	}{
+		"equal trees": {
+			givenReceiver: map[string]testEntry{
+				"dir":       {mode: 0755},
+				"dir/large": {data: large, mode: 0644},
+				"small":     {data: []byte("small"), mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"dir":       {mode: 0755},
+				"dir/large": {data: large, mode: 0644},
+				"small":     {data: []byte("small"), mode: 0644},
+			},
+			expectedChangeTypes: map[string]ChangeType{},
+		},
+		"created, updated and deleted entries": {
+			givenReceiver: map[string]testEntry{
+				"dir":       {mode: 0755},
+				"dir/large": {data: large, mode: 0644},
+				"dir/old":   {data: []byte("old"), mode: 0644},
+				"gone":      {mode: 0755},
+				"gone/file": {data: []byte("gone"), mode: 0644},
+				"small":     {data: []byte("small"), mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"dir":       {mode: 0755},
+				"dir/large": {data: updated, mode: 0644},
+				"dir/new":   {data: []byte("new"), mode: 0600},
+				"empty":     {data: []byte{}, mode: 0644},
+				"new":       {mode: 0700},
+				"small":     {data: []byte("SMALL"), mode: 0644},
+			},
+			expectedChangeTypes: map[string]ChangeType{
+				"dir/large": ChangeTypeUpdate,
+				"dir/new":   ChangeTypeCreate,
+				"dir/old":   ChangeTypeDelete,
+				"empty":     ChangeTypeCreate,
+				"gone":      ChangeTypeDelete,
+				"gone/file": ChangeTypeDelete,
+				"new":       ChangeTypeCreate,
+				"small":     ChangeTypeUpdate,
+			},
+		},
+		"renamed file and metadata changes": {
+			givenReceiver: map[string]testEntry{
+				"dir":       {mode: 0755},
+				"dir/large": {data: large, mode: 0644},
+				"script":    {data: []byte("#!/bin/sh"), mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"dir":         {mode: 0700},
+				"dir/renamed": {data: large, mode: 0644},
+				"script":      {data: []byte("#!/bin/sh"), mode: 0755},
+			},
+			expectedChangeTypes: map[string]ChangeType{
+				"dir":         ChangeTypeMetadata,
+				"dir/renamed": ChangeTypeRename,
+				"script":      ChangeTypeMetadata,
+			},
+		},
+		"file replaced with directory": {
+			givenReceiver: map[string]testEntry{
+				"entry": {data: []byte("file"), mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"entry":      {mode: 0755},
+				"entry/file": {data: []byte("file"), mode: 0644},
+			},
+			expectedChangeTypes: map[string]ChangeType{
+				"entry":      ChangeTypeCreate,
+				"entry/file": ChangeTypeCreate,
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			receiver := filepath.Join(t.TempDir(), "receiver")
+			sender := filepath.Join(t.TempDir(), "sender")
+			assert.NoError(t, os.Mkdir(receiver, 0755))
+			assert.NoError(t, os.Mkdir(sender, 0755))
+			writeTree(t, receiver, c.givenReceiver)
+			writeTree(t, sender, c.givenSender)
+			ctx := context.Background()
+
+			manifest, err := BuildManifest(ctx, receiver, 256)
+			assert.NoError(t, err)
+			encodedManifest := &bytes.Buffer{}
+			assert.NoError(t, WriteManifest(encodedManifest, manifest))
+			manifest, err = ReadManifest(encodedManifest)
+			assert.NoError(t, err)
+
+			changeset, err := Diff(ctx, sender, manifest)
+			assert.NoError(t, err)
+			encodedChangeset := &bytes.Buffer{}
+			assert.NoError(t, WriteChangeset(encodedChangeset, changeset))
+			changeset, err = ReadChangeset(encodedChangeset)
+			assert.NoError(t, err)
+
+			actualChangeTypes := make(map[string]ChangeType)
+			for _, change := range changeset.Changes {
+				actualChangeTypes[change.Path] = change.Type
+			}
+			assert.Equal(t, c.expectedChangeTypes, actualChangeTypes)
+
+			assert.NoError(t, Apply(ctx, receiver, manifest, changeset))
+			assert.Equal(t, readTestTree(t, sender), readTestTree(t, receiver))
+
+			// nothing is left next to receiver
+			siblings, err := ioutil.ReadDir(filepath.Dir(receiver))
+			assert.NoError(t, err)
+			assert.Len(t, siblings, 1)
+		})
+	}
+}
+
+func TestApply_Err(t *testing.T) {
+	receiver := filepath.Join(t.TempDir(), "receiver")
+	sender := filepath.Join(t.TempDir(), "sender")
+	assert.NoError(t, os.Mkdir(receiver, 0755))
+	assert.NoError(t, os.Mkdir(sender, 0755))
+	large := randomData(1, 10000)
+	writeTree(t, receiver, map[string]testEntry{
+		"large": {data: large, mode: 0644},
+		"small": {data: []byte("small"), mode: 0644},
+	})
+	writeTree(t, sender, map[string]testEntry{
+		"large": {data: append(large[:5000:5000], "changed"...), mode: 0644},
+		"small": {data: []byte("small"), mode: 0644},
+	})
+	ctx := context.Background()
+	manifest, err := BuildManifest(ctx, receiver, 256)
+	assert.NoError(t, err)
+	changeset, err := Diff(ctx, sender, manifest)
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		givenChangeset Changeset
+		modifyReceiver func()
+		expected       error
+	}{
+		"err receiver modified after manifest": {
+			givenChangeset: changeset,
+			modifyReceiver: func() {
+				f, err := os.OpenFile(filepath.Join(receiver, "large"), os.O_WRONLY, 0)
+				assert.NoError(t, err)
+				_, err = f.WriteAt([]byte("modified"), 100)
+				assert.NoError(t, err)
+				assert.NoError(t, f.Close())
+				assert.NoError(t, os.Chtimes(filepath.Join(receiver, "large"), testModTime, testModTime))
+			},
+			expected: rolling.ErrApplyChecksumMismatch,
+		},
+		"err path outside of tree": {
+			givenChangeset: Changeset{
+				Changes: []Change{
+					{Type: ChangeTypeCreate, Path: "../outside", Metadata: Metadata{Type: EntryTypeDir}},
+				},
+			},
+			expected: ErrInvalidChangeset,
+		},
+		"err deleted entry doesn't exist": {
+			givenChangeset: Changeset{
+				Changes: []Change{
+					{Type: ChangeTypeDelete, Path: "missing"},
+				},
+			},
+			expected: ErrInvalidChangeset,
+		},
+		"err parent doesn't exist": {
+			givenChangeset: Changeset{
+				Changes: []Change{
+					{Type: ChangeTypeCreate, Path: "missing/dir", Metadata: Metadata{Type: EntryTypeDir}},
+				},
+			},
+			expected: ErrInvalidChangeset,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if c.modifyReceiver != nil {
+				c.modifyReceiver()
+			}
+			before := readTestTree(t, receiver)
+
+			err := Apply(ctx, receiver, manifest, c.givenChangeset)
+			assert.Equal(t, c.expected, err)
+			assert.Equal(t, before, readTestTree(t, receiver))
+			siblings, err := ioutil.ReadDir(filepath.Dir(receiver))
+			assert.NoError(t, err)
+			assert.Len(t, siblings, 1)
+		})
+	}
+}
+
+func TestApply_InterruptedReplace(t *testing.T) {
+	receiverEntries := map[string]testEntry{
+		"file": {data: []byte("original"), mode: 0644},
+	}
+	senderEntries := map[string]testEntry{
+		"file": {data: []byte("updated"), mode: 0644},
+	}
+
+	cases := map[string]struct {
+		interrupt   func(t *testing.T, receiver string)
+		expected    map[string]testEntry
+		expectedErr error
+	}{
+		"root restored from backup": {
+			interrupt: func(t *testing.T, receiver string) {
+				staging := filepath.Join(filepath.Dir(receiver), ".receiver.sync-1")
+				assert.NoError(t, os.Rename(receiver, staging+".old"))
+				assert.NoError(t, os.Mkdir(staging, 0755))
+			},
+			expected: senderEntries,
+		},
+		"backup left after replace removed": {
+			interrupt: func(t *testing.T, receiver string) {
+				assert.NoError(t, os.Mkdir(filepath.Join(filepath.Dir(receiver), ".receiver.sync-1.old"), 0755))
+			},
+			expected: senderEntries,
+		},
+		"staging left by interrupted build removed": {
+			interrupt: func(t *testing.T, receiver string) {
+				staging := filepath.Join(filepath.Dir(receiver), ".receiver.sync-1")
+				assert.NoError(t, os.Mkdir(staging, 0755))
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(staging, "file"), []byte("partial"), 0644))
+			},
+			expected: senderEntries,
+		},
+		"err ambiguous backups": {
+			interrupt: func(t *testing.T, receiver string) {
+				parent := filepath.Dir(receiver)
+				assert.NoError(t, os.Rename(receiver, filepath.Join(parent, ".receiver.sync-1.old")))
+				assert.NoError(t, os.Mkdir(filepath.Join(parent, ".receiver.sync-2.old"), 0755))
+			},
+			expectedErr: ErrAmbiguousRootBackup,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			receiver := filepath.Join(t.TempDir(), "receiver")
+			sender := filepath.Join(t.TempDir(), "sender")
+			assert.NoError(t, os.Mkdir(receiver, 0755))
+			assert.NoError(t, os.Mkdir(sender, 0755))
+			writeTree(t, receiver, receiverEntries)
+			writeTree(t, sender, senderEntries)
+			ctx := context.Background()
+			manifest, err := BuildManifest(ctx, receiver, 4)
+			assert.NoError(t, err)
+			changeset, err := Diff(ctx, sender, manifest)
+			assert.NoError(t, err)
+			c.interrupt(t, receiver)
+
+			err = Apply(ctx, receiver, manifest, changeset)
+
+			assert.Equal(t, c.expectedErr, err)
+			if c.expectedErr != nil {
+				return
+			}
+			assert.Equal(t, c.expected, readTestTree(t, receiver))
+			siblings, err := ioutil.ReadDir(filepath.Dir(receiver))
+			assert.NoError(t, err)
+			assert.Len(t, siblings, 1)
+		})
+	}
+}
+
+func TestDiff_Similarity(t *testing.T) {
+	large := randomData(1, 10000)
+	other := randomData(2, 10000)
+	modified := append(append([]byte{}, large[:8192]...), "modified tail"...)
+
+	cases := map[string]struct {
+		givenReceiver map[string]testEntry
+		givenSender   map[string]testEntry
+		givenOptions  []Option
+		expected      map[string]Change
+		expectedAdded int
+	}{
+		"renamed and modified file": {
+			givenReceiver: map[string]testEntry{
+				"a":     {data: large, mode: 0644},
+				"other": {data: other, mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"b":     {data: modified, mode: 0644},
+				"other": {data: other, mode: 0644},
+			},
+			expected: map[string]Change{
+				"b": {Type: ChangeTypeRename, Basis: "a"},
+			},
+			expectedAdded: len("modified tail"),
+		},
+		"copied and modified file": {
+			givenReceiver: map[string]testEntry{
+				"a": {data: large, mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"a":    {data: large, mode: 0644},
+				"copy": {data: modified, mode: 0644},
+			},
+			expected: map[string]Change{
+				"copy": {Type: ChangeTypeCreate, Basis: "a"},
+			},
+			expectedAdded: len("modified tail"),
+		},
+		"file renamed twice is renamed and copied": {
+			givenReceiver: map[string]testEntry{
+				"a": {data: large, mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"b": {data: large, mode: 0644},
+				"c": {data: modified, mode: 0644},
+			},
+			expected: map[string]Change{
+				"b": {Type: ChangeTypeRename, Basis: "a"},
+				"c": {Type: ChangeTypeCreate, Basis: "a"},
+			},
+			expectedAdded: len("modified tail"),
+		},
+		"the most similar file is basis": {
+			givenReceiver: map[string]testEntry{
+				"half":  {data: append(append([]byte{}, large[:5120]...), other[5120:]...), mode: 0644},
+				"most":  {data: append(append([]byte{}, large[:7680]...), other[7680:]...), mode: 0644},
+				"other": {data: other, mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"half":  {data: append(append([]byte{}, large[:5120]...), other[5120:]...), mode: 0644},
+				"most":  {data: append(append([]byte{}, large[:7680]...), other[7680:]...), mode: 0644},
+				"new":   {data: large, mode: 0644},
+				"other": {data: other, mode: 0644},
+			},
+			expected: map[string]Change{
+				"new": {Type: ChangeTypeCreate, Basis: "most"},
+			},
+			expectedAdded: 10000 - 7680,
+		},
+		"not similar enough file is created": {
+			givenReceiver: map[string]testEntry{
+				"a": {data: large, mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"a":   {data: large, mode: 0644},
+				"new": {data: append(append([]byte{}, large[:2560]...), other[2560:]...), mode: 0644},
+			},
+			expected: map[string]Change{
+				"new": {Type: ChangeTypeCreate},
+			},
+			expectedAdded: 10000,
+		},
+		"similarity matching disabled": {
+			givenReceiver: map[string]testEntry{
+				"a": {data: large, mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"b": {data: modified, mode: 0644},
+			},
+			givenOptions: []Option{WithSimilarityThreshold(1.1)},
+			expected: map[string]Change{
+				"a": {Type: ChangeTypeDelete},
+				"b": {Type: ChangeTypeCreate},
+			},
+			expectedAdded: len(modified),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			receiver := filepath.Join(t.TempDir(), "receiver")
+			sender := filepath.Join(t.TempDir(), "sender")
+			assert.NoError(t, os.Mkdir(receiver, 0755))
+			assert.NoError(t, os.Mkdir(sender, 0755))
+			writeTree(t, receiver, c.givenReceiver)
+			writeTree(t, sender, c.givenSender)
+			ctx := context.Background()
+
+			manifest, err := BuildManifest(ctx, receiver, 256)
+			assert.NoError(t, err)
+			changeset, err := Diff(ctx, sender, manifest, c.givenOptions...)
+			assert.NoError(t, err)
+
+			actual := make(map[string]Change)
+			actualAdded := 0
+			for _, change := range changeset.Changes {
+				actual[change.Path] = Change{Type: change.Type, Basis: change.Basis}
+				for _, op := range change.Delta.Operations {
+					actualAdded += len(op.Data)
+				}
+			}
+			assert.Equal(t, c.expected, actual)
+			assert.Equal(t, c.expectedAdded, actualAdded)
+
+			assert.NoError(t, Apply(ctx, receiver, manifest, changeset))
+			assert.Equal(t, readTestTree(t, sender), readTestTree(t, receiver))
+		})
+	}
+}
+
+func TestSync_Metadata(t *testing.T) {
+	large := randomData(1, 10000)
+	updated := append(append([]byte{}, large[:5000]...), "changed"...)
+
+	cases := map[string]struct {
+		givenReceiver       map[string]testEntry
+		givenSender         map[string]testEntry
+		expectedChangeTypes map[string]ChangeType
+	}{
+		"symbolic links": {
+			givenReceiver: map[string]testEntry{
+				"file":    {data: []byte("file"), mode: 0644},
+				"changed": {link: "file"},
+				"same":    {link: "file"},
+				"was":     {link: "file"},
+			},
+			givenSender: map[string]testEntry{
+				"file":     {data: []byte("file"), mode: 0644},
+				"changed":  {link: "../outside"},
+				"same":     {link: "file"},
+				"was":      {data: []byte("was"), mode: 0644},
+				"dangling": {link: "missing/file"},
+			},
+			expectedChangeTypes: map[string]ChangeType{
+				"changed":  ChangeTypeMetadata,
+				"dangling": ChangeTypeCreate,
+				"was":      ChangeTypeCreate,
+			},
+		},
+		"hard links": {
+			givenReceiver: map[string]testEntry{
+				"a":        {data: large, mode: 0644},
+				"b":        {hardlink: "a"},
+				"separate": {data: []byte("separate"), mode: 0644},
+			},
+			givenSender: map[string]testEntry{
+				"a":        {data: updated, mode: 0644},
+				"b":        {hardlink: "a"},
+				"c":        {hardlink: "a"},
+				"separate": {data: []byte("separate"), mode: 0644},
+				"x":        {hardlink: "separate"},
+			},
+			expectedChangeTypes: map[string]ChangeType{
+				"a": ChangeTypeUpdate,
+				"c": ChangeTypeCreate,
+				"x": ChangeTypeCreate,
+			},
+		},
+		"special mode bits and directory times": {
+			givenReceiver: map[string]testEntry{
+				"shared":      {mode: 0755},
+				"shared/file": {data: []byte("file"), mode: 0644},
+				"tmp":         {mode: 0777},
+				"readonly":    {mode: 0755},
+			},
+			givenSender: map[string]testEntry{
+				"shared":      {mode: 0755 | os.ModeSetgid},
+				"shared/file": {data: []byte("file"), mode: 0644},
+				"tmp":         {mode: 0777 | os.ModeSticky},
+				"readonly":    {mode: 0555},
+				"readonly/f":  {data: []byte("f"), mode: 0444},
+				"empty":       {mode: 0700},
+			},
+			expectedChangeTypes: map[string]ChangeType{
+				"empty":      ChangeTypeCreate,
+				"readonly":   ChangeTypeMetadata,
+				"readonly/f": ChangeTypeCreate,
+				"shared":     ChangeTypeMetadata,
+				"tmp":        ChangeTypeMetadata,
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			receiver := filepath.Join(t.TempDir(), "receiver")
+			sender := filepath.Join(t.TempDir(), "sender")
+			assert.NoError(t, os.Mkdir(receiver, 0755))
+			assert.NoError(t, os.Mkdir(sender, 0755))
+			writeTree(t, receiver, c.givenReceiver)
+			writeTree(t, sender, c.givenSender)
+			ctx := context.Background()
+
+			manifest, err := BuildManifest(ctx, receiver, 256)
+			assert.NoError(t, err)
+			encodedManifest := &bytes.Buffer{}
+			assert.NoError(t, WriteManifest(encodedManifest, manifest))
+			manifest, err = ReadManifest(encodedManifest)
+			assert.NoError(t, err)
+
+			changeset, err := Diff(ctx, sender, manifest)
+			assert.NoError(t, err)
+			encodedChangeset := &bytes.Buffer{}
+			assert.NoError(t, WriteChangeset(encodedChangeset, changeset))
+			changeset, err = ReadChangeset(encodedChangeset)
+			assert.NoError(t, err)
+
+			actualChangeTypes := make(map[string]ChangeType)
+			for _, change := range changeset.Changes {
+				actualChangeTypes[change.Path] = change.Type
+			}
+			assert.Equal(t, c.expectedChangeTypes, actualChangeTypes)
+
+			assert.NoError(t, Apply(ctx, receiver, manifest, changeset))
+			assert.Equal(t, readTestTree(t, sender), readTestTree(t, receiver))
+
+			// tree read again is in sync
+			manifest, err = BuildManifest(ctx, receiver, 256)
+			assert.NoError(t, err)
+			changeset, err = Diff(ctx, sender, manifest)
+			assert.NoError(t, err)
+			assert.Empty(t, changeset.Changes)
+		})
+	}
+}
+
+func TestSync_OwnershipAndXattrs(t *testing.T) {
+	receiver := filepath.Join(t.TempDir(), "receiver")
+	sender := filepath.Join(t.TempDir(), "sender")
+	assert.NoError(t, os.Mkdir(receiver, 0755))
+	assert.NoError(t, os.Mkdir(sender, 0755))
+	writeTree(t, receiver, map[string]testEntry{
+		"file": {data: []byte("file"), mode: 0644},
+	})
+	writeTree(t, sender, map[string]testEntry{
+		"file": {data: []byte("file"), mode: 0644},
+	})
+	if err := writeXattrs(filepath.Join(sender, "file"), map[string][]byte{"user.origin": []byte("sender")}); err != nil {
+		t.Skip("extended attributes aren't supported:", err)
+	}
+	ctx := context.Background()
+	opts := []Option{WithOwnership(), WithXattrs()}
+
+	manifest, err := BuildManifest(ctx, receiver, 256, opts...)
+	assert.NoError(t, err)
+	changeset, err := Diff(ctx, sender, manifest, opts...)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changeset.Changes))
+	assert.Equal(t, ChangeTypeMetadata, changeset.Changes[0].Type)
+	assert.Equal(t, os.Getuid(), changeset.Changes[0].UID)
+
+	assert.NoError(t, Apply(ctx, receiver, manifest, changeset, opts...))
+	xattrs, err := readXattrs(filepath.Join(receiver, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user.origin": []byte("sender")}, xattrs)
+
+	// extended attributes are ignored by default
+	manifest, err = BuildManifest(ctx, receiver, 256)
+	assert.NoError(t, err)
+	assert.Nil(t, manifest.Entries[0].Xattrs)
+}
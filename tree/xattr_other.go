@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package tree
+
+import "errors"
+
+var errXattrsNotSupported = errors.New("extended attributes aren't supported on this platform")
+
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, errXattrsNotSupported
+}
+
+func writeXattrs(path string, xattrs map[string][]byte) error {
+	if len(xattrs) == 0 {
+		return nil
+	}
+	return errXattrsNotSupported
+}
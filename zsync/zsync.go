@@ -0,0 +1,258 @@
+// Package zsync implements client side synchronization of files published on plain HTTP servers.
+//
+// Publisher generates control file, encoded signature of the new file version, and puts it next to the file.
+// Client matches chunks of its old copy against the control file, fetches only missing byte ranges
+// with HTTP Range requests and assembles the new file. Every chunk is verified against the control file.
+//
+// Like DeltaCalculator, chunks of old copy are matched only at offsets being multiples of chunk size.
+package zsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/httpx"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/iox"
+	"github.com/jakub-gawlas/go-rolling-hash-diff/internal/mathx"
+)
+
+const (
+	// DefaultMaxRangeSize limits size of one range request
+	DefaultMaxRangeSize = 4 * 1024 * 1024
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+	ErrRangeNotSupported    = errors.New("server doesn't support range requests")
+	ErrChunkMismatch        = errors.New("fetched chunk doesn't match control file")
+)
+
+// StatusError is returned when server responds with unexpected status
+type StatusError = httpx.StatusError
+
+// Stats describes sources of synchronized data
+type Stats struct {
+	// LocalBytes is number of bytes copied from old copy
+	LocalBytes int64
+	// FetchedBytes is number of bytes fetched from server
+	FetchedBytes int64
+	// Requests is number of range requests
+	Requests int
+}
+
+// WriteControlFile writes control file of data read from r, data of two chunks or fewer is described too
+func WriteControlFile(w io.Writer, r io.Reader, chunkSize int) error {
+	if chunkSize <= 0 {
+		return rolling.ErrCalculateSignatureInvalidChunkSize
+	}
+	// small input gives empty signature, but control file has to describe the data, so hashes are kept aside
+	chunksHashes := make([][]byte, 0)
+	calc := rolling.NewSignatureCalculator(chunkSize, rolling.WithSmallInput(), rolling.WithChunkHashHandler(func(hash []byte) error {
+		chunksHashes = append(chunksHashes, hash)
+		return nil
+	}))
+	size, err := io.Copy(&calc, r)
+	if err != nil {
+		return err
+	}
+	signature, err := calc.Signature()
+	if err != nil {
+		return err
+	}
+	signature.ChunksHashes = chunksHashes
+	signature.Size = size
+	return rolling.WriteSignature(w, signature)
+}
+
+type Client struct {
+	httpClient   *http.Client
+	maxRangeSize int64
+}
+
+// NewClient returns client using given http client, http.DefaultClient is used if it's nil
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		httpClient:   httpClient,
+		maxRangeSize: DefaultMaxRangeSize,
+	}
+}
+
+// SetMaxRangeSize sets limit of bytes fetched by one range request
+func (c *Client) SetMaxRangeSize(size int64) {
+	c.maxRangeSize = size
+}
+
+// FetchControlFile fetches and decodes control file from url
+func (c *Client) FetchControlFile(ctx context.Context, url string) (rolling.Signature, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return rolling.Signature{}, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return rolling.Signature{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return rolling.Signature{}, httpx.NewStatusError(resp)
+	}
+	return rolling.ReadSignature(resp.Body)
+}
+
+// Sync writes to out file described by control, chunks found in first localSize bytes of local are copied,
+// missing chunks are fetched from url
+func (c *Client) Sync(ctx context.Context, url string, control rolling.Signature, local io.ReaderAt, localSize int64, out io.Writer) (Stats, error) {
+	if control.Algorithm != rolling.AlgorithmSHA256 {
+		return Stats{}, ErrUnsupportedAlgorithm
+	}
+	if err := rolling.ValidateSignatureSize(control); err != nil {
+		return Stats{}, err
+	}
+	// chunk size comes from downloaded control file, buffers of that size are allocated below
+	if control.ChunkSize > rolling.MaxChunkSize {
+		return Stats{}, rolling.ErrChunkSizeAboveLimit
+	}
+
+	sources, err := matchLocalChunks(ctx, control, local, localSize)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{}
+	chunkSize := int64(control.ChunkSize)
+	buf := make([]byte, chunkSize)
+	for i := 0; i < len(control.ChunksHashes); {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		length := chunkLength(control, i)
+		if source, ok := sources[i]; ok {
+			if err := iox.ReadFullAt(local, buf[:length], source); err != nil {
+				return stats, err
+			}
+			if _, err := out.Write(buf[:length]); err != nil {
+				return stats, err
+			}
+			stats.LocalBytes += length
+			i++
+			continue
+		}
+
+		// missing chunks following each other are fetched by one request
+		to := i + 1
+		for to < len(control.ChunksHashes) && !hasSource(sources, to) && int64(to+1-i)*chunkSize <= c.maxRangeSize {
+			to++
+		}
+		n, err := c.fetchChunks(ctx, url, control, i, to, out)
+		stats.FetchedBytes += n
+		stats.Requests++
+		if err != nil {
+			return stats, err
+		}
+		i = to
+	}
+	return stats, nil
+}
+
+// fetches chunks [from, to) with one range request, verifies and writes them to out
+func (c *Client) fetchChunks(ctx context.Context, url string, control rolling.Signature, from, to int, out io.Writer) (int64, error) {
+	chunkSize := int64(control.ChunkSize)
+	start := int64(from) * chunkSize
+	end := int64(to-1)*chunkSize + chunkLength(control, to-1)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// whole content is valid response only if the range covers it
+		if start != 0 || end != control.Size {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1024))
+			return 0, ErrRangeNotSupported
+		}
+	default:
+		return 0, httpx.NewStatusError(resp)
+	}
+
+	fetched := int64(0)
+	buf := make([]byte, chunkSize)
+	for i := from; i < to; i++ {
+		chunk := buf[:chunkLength(control, i)]
+		n, err := io.ReadFull(resp.Body, chunk)
+		fetched += int64(n)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrChunkMismatch
+			}
+			return fetched, err
+		}
+		hash := sha256.Sum256(chunk)
+		if !bytes.Equal(hash[:], control.ChunksHashes[i]) {
+			return fetched, ErrChunkMismatch
+		}
+		if _, err := out.Write(chunk); err != nil {
+			return fetched, err
+		}
+	}
+	return fetched, nil
+}
+
+// returns offsets in local data of chunks described by control, indexed by chunk index
+func matchLocalChunks(ctx context.Context, control rolling.Signature, local io.ReaderAt, localSize int64) (map[int]int64, error) {
+	wanted := make(map[string][]int, len(control.ChunksHashes))
+	for i, hash := range control.ChunksHashes {
+		wanted[string(hash)] = append(wanted[string(hash)], i)
+	}
+
+	sources := make(map[int]int64)
+	chunkSize := int64(control.ChunkSize)
+	buf := make([]byte, chunkSize)
+	for offset := int64(0); offset < localSize; offset += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		chunk := buf[:mathx.MinInt64(chunkSize, localSize-offset)]
+		if err := iox.ReadFullAt(local, chunk, offset); err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(chunk)
+		for _, i := range wanted[string(hash[:])] {
+			sources[i] = offset
+		}
+		delete(wanted, string(hash[:]))
+	}
+	return sources, nil
+}
+
+func hasSource(sources map[int]int64, i int) bool {
+	_, ok := sources[i]
+	return ok
+}
+
+// returns length of chunk with given index
+func chunkLength(signature rolling.Signature, i int) int64 {
+	chunkSize := int64(signature.ChunkSize)
+	return mathx.MinInt64(chunkSize, signature.Size-int64(i)*chunkSize)
+}
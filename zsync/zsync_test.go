@@ -0,0 +1,206 @@
+package zsync
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rolling "github.com/jakub-gawlas/go-rolling-hash-diff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Sync(t *testing.T) {
+	old := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	updated := append([]byte{}, old...)
+	copy(updated[30000:], "changed")
+	updated = append(updated, "appended tail"...)
+
+	control := &bytes.Buffer{}
+	assert.NoError(t, WriteControlFile(control, bytes.NewReader(updated), 64))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(updated))
+	})
+	mux.HandleFunc("/file.zsync", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(control.Bytes())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cases := map[string]struct {
+		givenLocal           []byte
+		givenMaxRangeSize    int64
+		expectedLocalBytes   int64
+		expectedFetchedBytes int64
+		expectedRequests     int
+	}{
+		"old copy": {
+			givenLocal:           old,
+			givenMaxRangeSize:    DefaultMaxRangeSize,
+			expectedLocalBytes:   int64(len(old)) - 64,
+			expectedFetchedBytes: 64 + 13,
+			expectedRequests:     2,
+		},
+		"up to date copy": {
+			givenLocal:         updated,
+			givenMaxRangeSize:  DefaultMaxRangeSize,
+			expectedLocalBytes: int64(len(updated)),
+		},
+		"empty copy": {
+			givenLocal:           []byte{},
+			givenMaxRangeSize:    DefaultMaxRangeSize,
+			expectedFetchedBytes: int64(len(updated)),
+			expectedRequests:     1,
+		},
+		"empty copy, limited range size": {
+			givenLocal:           []byte{},
+			givenMaxRangeSize:    16 * 1024,
+			expectedFetchedBytes: int64(len(updated)),
+			expectedRequests:     5,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := NewClient(nil)
+			client.SetMaxRangeSize(c.givenMaxRangeSize)
+			ctx := context.Background()
+
+			signature, err := client.FetchControlFile(ctx, server.URL+"/file.zsync")
+			assert.NoError(t, err)
+
+			out := &bytes.Buffer{}
+			actual, err := client.Sync(ctx, server.URL+"/file", signature, bytes.NewReader(c.givenLocal), int64(len(c.givenLocal)), out)
+			assert.NoError(t, err)
+			assert.Equal(t, updated, out.Bytes())
+			assert.Equal(t, Stats{
+				LocalBytes:   c.expectedLocalBytes,
+				FetchedBytes: c.expectedFetchedBytes,
+				Requests:     c.expectedRequests,
+			}, actual)
+		})
+	}
+}
+
+func TestClient_Sync_SmallFile(t *testing.T) {
+	cases := map[string]struct {
+		givenPublished []byte
+		givenLocal     []byte
+	}{
+		"empty file": {
+			givenPublished: []byte{},
+			givenLocal:     []byte("old"),
+		},
+		"one chunk": {
+			givenPublished: []byte("abc"),
+			givenLocal:     []byte{},
+		},
+		"two chunks": {
+			givenPublished: []byte("abcdefgh"),
+			givenLocal:     []byte("abcd"),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			control := &bytes.Buffer{}
+			assert.NoError(t, WriteControlFile(control, bytes.NewReader(c.givenPublished), 4))
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(c.givenPublished))
+			}))
+			defer server.Close()
+
+			signature, err := rolling.ReadSignature(bytes.NewReader(control.Bytes()))
+			assert.NoError(t, err)
+			out := &bytes.Buffer{}
+			_, err = NewClient(nil).Sync(context.Background(), server.URL, signature, bytes.NewReader(c.givenLocal), int64(len(c.givenLocal)), out)
+			assert.NoError(t, err)
+			assert.Equal(t, string(c.givenPublished), out.String())
+		})
+	}
+}
+
+func TestClient_Sync_Err(t *testing.T) {
+	published := make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(published)
+	control := &bytes.Buffer{}
+	assert.NoError(t, WriteControlFile(control, bytes.NewReader(published), 64))
+	local := published[:512]
+
+	cases := map[string]struct {
+		givenHandler http.HandlerFunc
+		expected     error
+	}{
+		"err file changed after publishing": {
+			givenHandler: func(w http.ResponseWriter, r *http.Request) {
+				changed := append([]byte{}, published...)
+				copy(changed[600:], "changed")
+				http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(changed))
+			},
+			expected: ErrChunkMismatch,
+		},
+		"err range not supported": {
+			givenHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(published)
+			},
+			expected: ErrRangeNotSupported,
+		},
+		"err not found": {
+			givenHandler: http.NotFound,
+			expected:     &StatusError{StatusCode: http.StatusNotFound, Message: "404 page not found"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(c.givenHandler)
+			defer server.Close()
+
+			client := NewClient(nil)
+			ctx := context.Background()
+			signature, err := rolling.ReadSignature(bytes.NewReader(control.Bytes()))
+			assert.NoError(t, err)
+
+			_, err = client.Sync(ctx, server.URL, signature, bytes.NewReader(local), int64(len(local)), &bytes.Buffer{})
+			assert.Equal(t, c.expected, err)
+		})
+	}
+}
+
+func TestClient_Sync_ErrInvalidControl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader([]byte("ab")))
+	}))
+	defer server.Close()
+
+	hashes := [][]byte{make([]byte, 32), make([]byte, 32), make([]byte, 32)}
+	cases := map[string]struct {
+		givenControl rolling.Signature
+		expected     error
+	}{
+		"err size smaller than chunks": {
+			givenControl: rolling.Signature{ChunkSize: 4, ChunksHashes: hashes, Size: 2},
+			expected:     rolling.ErrSignatureInvalidSize,
+		},
+		"err size larger than chunks": {
+			givenControl: rolling.Signature{ChunkSize: 4, ChunksHashes: hashes, Size: 13},
+			expected:     rolling.ErrSignatureInvalidSize,
+		},
+		"err invalid chunk size": {
+			givenControl: rolling.Signature{ChunkSize: 0, ChunksHashes: hashes, Size: 2},
+			expected:     rolling.ErrCalculateSignatureInvalidChunkSize,
+		},
+		"err chunk size above limit": {
+			givenControl: rolling.Signature{ChunkSize: rolling.MaxChunkSize + 1, ChunksHashes: hashes[:1], Size: 2},
+			expected:     rolling.ErrChunkSizeAboveLimit,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewClient(nil).Sync(context.Background(), server.URL, c.givenControl, bytes.NewReader([]byte{}), 0, &bytes.Buffer{})
+			assert.Equal(t, c.expected, err)
+		})
+	}
+}